@@ -0,0 +1,303 @@
+package uow
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrFactoryClosed is returned by CachingFactory after Close
+	ErrFactoryClosed = errors.New("factory closed")
+)
+
+// EvictFunc is called when CachingFactory evicts a TransactionalDb
+type EvictFunc func(key string, db TransactionalDb) error
+
+// CachingFactory memoize TransactionalDb resolved by DbFactory per formatted key.
+// It limits the number of cached dbs, evicts idle ones, and closes all of them on Close.
+// A db is in use until transactions began from it by unit of work end, see OnRelease. Dbs in use are never evicted,
+// and are released after their transactions end if the factory is closed meanwhile
+type CachingFactory struct {
+	factory     DbFactory
+	formatter   KeyFormatter
+	maxSize     int
+	idleTimeout time.Duration
+	onEvict     EvictFunc
+
+	mtx     sync.Mutex
+	entries map[string]*list.Element
+	// lru front is the most recently used
+	lru    *list.List
+	closed bool
+	stop   chan struct{}
+}
+
+type cacheEntry struct {
+	key      string
+	db       TransactionalDb
+	lastUsed time.Time
+	// ready is closed after db resolved
+	ready chan struct{}
+	err   error
+	// refs counts transactions in use, evicted db is released when refs drops to zero
+	refs    int
+	evicted bool
+}
+
+type CachingOption func(*CachingFactory)
+
+// WithMaxSize limit the number of cached dbs. The least recently used one is evicted when exceeded. zero means unlimited
+func WithMaxSize(n int) CachingOption {
+	return func(f *CachingFactory) {
+		f.maxSize = n
+	}
+}
+
+// WithIdleTimeout evict dbs which are not resolved for [d]. zero means never
+func WithIdleTimeout(d time.Duration) CachingOption {
+	return func(f *CachingFactory) {
+		f.idleTimeout = d
+	}
+}
+
+// WithEvictFunc change how evicted dbs are released. default closes db if it implements io.Closer
+func WithEvictFunc(fn EvictFunc) CachingOption {
+	return func(f *CachingFactory) {
+		f.onEvict = fn
+	}
+}
+
+// WithCachingKeyFormatter change how keys are formatted into cache keys. default is DefaultKeyFormatter
+func WithCachingKeyFormatter(formatter KeyFormatter) CachingOption {
+	return func(f *CachingFactory) {
+		f.formatter = formatter
+	}
+}
+
+func closeEvicted(key string, db TransactionalDb) error {
+	if c, ok := db.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// NewCachingFactory wrap [factory] with cache. Pass Resolve to NewManager as DbFactory, and WithCloser to close it with Manager
+func NewCachingFactory(factory DbFactory, opts ...CachingOption) *CachingFactory {
+	f := &CachingFactory{
+		factory:   factory,
+		formatter: DefaultKeyFormatter,
+		onEvict:   closeEvicted,
+		entries:   map[string]*list.Element{},
+		lru:       list.New(),
+		stop:      make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	if f.idleTimeout > 0 {
+		go f.janitor()
+	}
+	return f
+}
+
+// Resolve is a DbFactory which returns cached db, or resolves from the wrapped factory exactly once per key
+func (f *CachingFactory) Resolve(ctx context.Context, keys ...string) (TransactionalDb, error) {
+	key := f.formatter(keys...)
+	f.mtx.Lock()
+	if f.closed {
+		f.mtx.Unlock()
+		return nil, ErrFactoryClosed
+	}
+	el, ok := f.entries[key]
+	var e *cacheEntry
+	if ok {
+		e = el.Value.(*cacheEntry)
+		e.lastUsed = time.Now()
+		f.lru.MoveToFront(el)
+	} else {
+		e = &cacheEntry{key: key, lastUsed: time.Now(), ready: make(chan struct{})}
+		f.entries[key] = f.lru.PushFront(e)
+	}
+	//register only once entry is known, release runs even if Resolve fails below
+	if OnRelease(ctx, func() {
+		f.release(e)
+	}) {
+		e.refs++
+	}
+	if ok {
+		f.mtx.Unlock()
+		<-e.ready
+		if e.err != nil {
+			return nil, e.err
+		}
+		return e.db, nil
+	}
+	f.mtx.Unlock()
+
+	db, err := f.factory(ctx, keys...)
+
+	f.mtx.Lock()
+	e.db, e.err = db, err
+	closed := err == nil && f.closed
+	if closed {
+		//closed while resolving
+		e.err = ErrFactoryClosed
+	}
+	close(e.ready)
+	if e.err != nil {
+		f.remove(key)
+		f.mtx.Unlock()
+		if closed {
+			_ = f.evict([]*cacheEntry{{key: key, db: db}})
+		}
+		return nil, e.err
+	}
+	evicted := f.shrink()
+	f.mtx.Unlock()
+	//failing to release evicted dbs should not fail this one
+	_ = f.evict(evicted)
+	return db, nil
+}
+
+// EvictIdle evict dbs not in use and idle longer than idle timeout. It is called periodically if WithIdleTimeout is set
+func (f *CachingFactory) EvictIdle() error {
+	if f.idleTimeout <= 0 {
+		return nil
+	}
+	f.mtx.Lock()
+	var evicted []*cacheEntry
+	deadline := time.Now().Add(-f.idleTimeout)
+	for el := f.lru.Back(); el != nil; {
+		e := el.Value.(*cacheEntry)
+		prev := el.Prev()
+		if e.lastUsed.Before(deadline) && e.isReady() && e.refs == 0 {
+			evicted = append(evicted, e)
+			f.remove(e.key)
+		}
+		el = prev
+	}
+	f.mtx.Unlock()
+	return f.evict(evicted)
+}
+
+// Len return the number of cached dbs
+func (f *CachingFactory) Len() int {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return f.lru.Len()
+}
+
+// Close evict all cached dbs. Dbs in use are released after their transactions end,
+// and dbs still resolving are released once resolved. Resolve fails with ErrFactoryClosed afterwards
+func (f *CachingFactory) Close() error {
+	f.mtx.Lock()
+	if f.closed {
+		f.mtx.Unlock()
+		return nil
+	}
+	f.closed = true
+	close(f.stop)
+	var evicted []*cacheEntry
+	for el := f.lru.Back(); el != nil; el = el.Prev() {
+		e := el.Value.(*cacheEntry)
+		if !e.isReady() {
+			continue
+		}
+		if e.refs > 0 {
+			e.evicted = true
+			continue
+		}
+		evicted = append(evicted, e)
+	}
+	f.entries = map[string]*list.Element{}
+	f.lru.Init()
+	f.mtx.Unlock()
+	return f.evict(evicted)
+}
+
+func (e *cacheEntry) isReady() bool {
+	select {
+	case <-e.ready:
+		return e.err == nil
+	default:
+		return false
+	}
+}
+
+// shrink remove least recently used entries not in use exceeding max size. must hold lock
+func (f *CachingFactory) shrink() []*cacheEntry {
+	if f.maxSize <= 0 {
+		return nil
+	}
+	var evicted []*cacheEntry
+	for el := f.lru.Back(); el != nil && f.lru.Len() > f.maxSize; {
+		e := el.Value.(*cacheEntry)
+		prev := el.Prev()
+		//entries still resolving or in use are skipped
+		if e.isReady() && e.refs == 0 {
+			evicted = append(evicted, e)
+			f.remove(e.key)
+		}
+		el = prev
+	}
+	return evicted
+}
+
+// release transaction of entry, evicted entry is released when not in use anymore.
+// The cache shrinks as the entry may be skipped by shrink before
+func (f *CachingFactory) release(e *cacheEntry) {
+	f.mtx.Lock()
+	e.refs--
+	var evicted []*cacheEntry
+	if e.refs == 0 {
+		if e.evicted {
+			evicted = append(evicted, e)
+		} else if e.err == nil {
+			evicted = f.shrink()
+		}
+	}
+	f.mtx.Unlock()
+	_ = f.evict(evicted)
+}
+
+// remove entry of key. must hold lock
+func (f *CachingFactory) remove(key string) {
+	if el, ok := f.entries[key]; ok {
+		f.lru.Remove(el)
+		delete(f.entries, key)
+	}
+}
+
+func (f *CachingFactory) evict(entries []*cacheEntry) error {
+	var errs []*KeyError
+	for _, e := range entries {
+		if err := f.onEvict(e.key, e.db); err != nil {
+			errs = append(errs, &KeyError{Key: e.key, Err: err})
+		}
+	}
+	if len(errs) > 0 {
+		return keyErrors(errs)
+	}
+	return nil
+}
+
+func (f *CachingFactory) janitor() {
+	interval := f.idleTimeout / 2
+	if interval <= 0 {
+		interval = f.idleTimeout
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+			_ = f.EvictIdle()
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package uow
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrPanicked is passed to RolledBackFunc and CompletedFunc when unit of work function panics
+	ErrPanicked = errors.New("unit of work function panicked")
+)
+
+// CommittedFunc runs after unit of work commits
+type CommittedFunc func(ctx context.Context)
+
+// RolledBackFunc runs after unit of work rolls back. err is the reason of rollback
+type RolledBackFunc func(ctx context.Context, err error)
+
+// CompletedFunc runs after unit of work finishes, err is nil if committed
+type CompletedFunc func(ctx context.Context, err error)
+
+type callbacks struct {
+	committed  []CommittedFunc
+	rolledBack []RolledBackFunc
+	completed  []CompletedFunc
+}
+
+// OnCommitted register fn to run after unit of work commits.
+//
+// For nested unit of work, fn waits until the outermost unit of work commits. If any ancestor rolls back, fn will not run
+func (u *UnitOfWork) OnCommitted(fn CommittedFunc) {
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+	u.callbacks.committed = append(u.callbacks.committed, fn)
+}
+
+// OnRolledBack register fn to run after unit of work rolls back.
+//
+// For nested unit of work, fn runs immediately if itself rolls back, or waits until any ancestor rolls back
+func (u *UnitOfWork) OnRolledBack(fn RolledBackFunc) {
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+	u.callbacks.rolledBack = append(u.callbacks.rolledBack, fn)
+}
+
+// OnCompleted register fn to run after unit of work commits or rolls back, following the same rule of nesting.
+// It always runs after CommittedFunc and RolledBackFunc
+func (u *UnitOfWork) OnCompleted(fn CompletedFunc) {
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+	u.callbacks.completed = append(u.callbacks.completed, fn)
+}
+
+// complete runs callbacks, or hands them over to parent if committed as nested unit of work
+func (u *UnitOfWork) complete(ctx context.Context, err error) {
+	u.mtx.Lock()
+	cbs := u.callbacks
+	u.callbacks = callbacks{}
+	u.mtx.Unlock()
+
+	if err == nil && u.parent != nil {
+		u.parent.mtx.Lock()
+		u.parent.callbacks.committed = append(u.parent.callbacks.committed, cbs.committed...)
+		u.parent.callbacks.rolledBack = append(u.parent.callbacks.rolledBack, cbs.rolledBack...)
+		u.parent.callbacks.completed = append(u.parent.callbacks.completed, cbs.completed...)
+		u.parent.mtx.Unlock()
+		return
+	}
+	if err == nil {
+		for _, fn := range cbs.committed {
+			fn(ctx)
+		}
+	} else {
+		for _, fn := range cbs.rolledBack {
+			fn(ctx, err)
+		}
+	}
+	for _, fn := range cbs.completed {
+		fn(ctx, err)
+	}
+}
@@ -1,6 +1,9 @@
 package uow
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type unitOfWorkKey string
 
@@ -14,5 +17,31 @@ func NewCurrentUow(ctx context.Context, u *UnitOfWork) context.Context {
 
 func FromCurrentUow(ctx context.Context) (u *UnitOfWork, ok bool) {
 	u, ok = ctx.Value(currentKey).(*UnitOfWork)
+	//nil means unit of work is suspended
+	return u, ok && u != nil
+}
+
+// detachedContext keeps values of parent but is never done, so that rollback can run after parent is canceled
+type detachedContext struct {
+	parent context.Context
+}
+
+func detach(ctx context.Context) context.Context {
+	return detachedContext{parent: ctx}
+}
+
+func (d detachedContext) Deadline() (deadline time.Time, ok bool) {
 	return
 }
+
+func (d detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (d detachedContext) Err() error {
+	return nil
+}
+
+func (d detachedContext) Value(key interface{}) interface{} {
+	return d.parent.Value(key)
+}
@@ -0,0 +1,24 @@
+package uow
+
+import "context"
+
+// KeyEnricher derive extra key parts from ctx, e.g. tenant, shard or region. Returned keys replace [keys].
+// Enriched keys are passed to KeyFormatter and DbFactory
+type KeyEnricher func(ctx context.Context, keys []string) []string
+
+// WithKeyEnricher enrich keys before resolving transactions. Multiple enrichers run in order
+func WithKeyEnricher(enrichers ...KeyEnricher) Option {
+	return func(config *Config) {
+		config.enrichers = append(config.enrichers, enrichers...)
+	}
+}
+
+// AppendKeyEnricher append the value returned by [fn] to keys, empty value is skipped
+func AppendKeyEnricher(fn func(ctx context.Context) string) KeyEnricher {
+	return func(ctx context.Context, keys []string) []string {
+		if v := fn(ctx); len(v) > 0 {
+			return append(append([]string(nil), keys...), v)
+		}
+		return keys
+	}
+}
@@ -0,0 +1,112 @@
+package uow
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// KeyError is an error of the transaction identified by Key. Key is formatted by KeyFormatter
+type KeyError struct {
+	Key string
+	Err error
+}
+
+func (e *KeyError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Key, e.Err.Error())
+}
+
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
+
+type keyErrors []*KeyError
+
+func (e keyErrors) Error() string {
+	s := make([]string, len(e))
+	for i, err := range e {
+		s[i] = err.Error()
+	}
+	return strings.Join(s, "\n")
+}
+
+func (e keyErrors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e keyErrors) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// CommitError is returned by UnitOfWork.Commit when some transactions fail to commit.
+// Committed transactions are durable, Failed and Skipped transactions are left to Rollback
+type CommitError struct {
+	// Committed keys successfully committed
+	Committed []string
+	// Failed keys tried to commit but failed
+	Failed []string
+	// Skipped keys never attempted to commit
+	Skipped []string
+	// Errs of Failed keys
+	Errs []*KeyError
+	// Rollback is set if rolling back prepared transactions fails in two-phase commit
+	Rollback *RollbackError
+}
+
+func (e *CommitError) Error() string {
+	msg := fmt.Sprintf("committed: [%s], failed: [%s], skipped: [%s]\n%s",
+		strings.Join(e.Committed, ","), strings.Join(e.Failed, ","), strings.Join(e.Skipped, ","), keyErrors(e.Errs).Error())
+	if e.Rollback != nil {
+		msg = msg + "\n" + e.Rollback.Error()
+	}
+	return msg
+}
+
+// Is reports whether any key error matches target
+func (e *CommitError) Is(target error) bool {
+	return keyErrors(e.Errs).Is(target) || (e.Rollback != nil && e.Rollback.Is(target))
+}
+
+// As finds the first key error that matches target
+func (e *CommitError) As(target interface{}) bool {
+	return keyErrors(e.Errs).As(target) || (e.Rollback != nil && e.Rollback.As(target))
+}
+
+// RollbackError aggregates errors of each transaction failing to roll back
+type RollbackError struct {
+	Errs []*KeyError
+	// Cause is the error which triggered rollback, if any
+	Cause error
+}
+
+func (e *RollbackError) Error() string {
+	msg := "rolling back transaction fail: " + keyErrors(e.Errs).Error()
+	if e.Cause != nil {
+		msg = msg + "\n " + e.Cause.Error()
+	}
+	return msg
+}
+
+// Is reports whether any key error matches target. Cause is checked through Unwrap
+func (e *RollbackError) Is(target error) bool {
+	return keyErrors(e.Errs).Is(target)
+}
+
+// As finds the first key error that matches target. Cause is checked through Unwrap
+func (e *RollbackError) As(target interface{}) bool {
+	return keyErrors(e.Errs).As(target)
+}
+
+func (e *RollbackError) Unwrap() error {
+	return e.Cause
+}
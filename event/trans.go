@@ -24,13 +24,19 @@ func NewTransactional(ctx context.Context, producer Producer) *Transactional {
 var (
 	_ uow.TransactionalDb = (*Transactional)(nil)
 	_ uow.Txn             = (*Transactional)(nil)
+	_ uow.TxnContext      = (*Transactional)(nil)
 )
 
 func (t *Transactional) Commit() error {
+	return t.CommitContext(t.ctx)
+}
+
+// CommitContext send all events with ctx
+func (t *Transactional) CommitContext(ctx context.Context) error {
 	if len(t.events) == 0 {
 		return nil
 	}
-	return t.producer.BatchSend(t.ctx, t.events)
+	return t.producer.BatchSend(ctx, t.events)
 }
 
 func (t *Transactional) Rollback() error {
@@ -38,6 +44,10 @@ func (t *Transactional) Rollback() error {
 	return nil
 }
 
+func (t *Transactional) RollbackContext(ctx context.Context) error {
+	return t.Rollback()
+}
+
 func (t *Transactional) Begin(opt ...*sql.TxOptions) (db uow.Txn, err error) {
 	return NewTransactional(t.ctx, t.producer), nil
 }
@@ -65,11 +75,11 @@ func (t *TransactionalProducer) Close() error {
 func (t *TransactionalProducer) Send(ctx context.Context, msg Event) error {
 	if u, ok := uow.FromCurrentUow(ctx); ok {
 		//resolve Transactional from unit of work
-		tx, err := u.GetTxDb(ctx, t.keys...)
+		tx, err := uow.GetTxFrom[*Transactional](ctx, u, t.keys...)
 		if err != nil {
 			return err
 		}
-		return tx.(*Transactional).Send(msg)
+		return tx.Send(msg)
 	} else {
 		return t.wrap.Send(ctx, msg)
 	}
@@ -78,11 +88,11 @@ func (t *TransactionalProducer) Send(ctx context.Context, msg Event) error {
 func (t *TransactionalProducer) BatchSend(ctx context.Context, msg []Event) error {
 	if u, ok := uow.FromCurrentUow(ctx); ok {
 		//resolve Transactional from unit of work
-		tx, err := u.GetTxDb(ctx, t.keys...)
+		tx, err := uow.GetTxFrom[*Transactional](ctx, u, t.keys...)
 		if err != nil {
 			return err
 		}
-		return tx.(*Transactional).Send(msg...)
+		return tx.Send(msg...)
 	} else {
 		return t.wrap.BatchSend(ctx, msg)
 	}
@@ -82,12 +82,10 @@ var _ Producer = (*producer)(nil)
 
 func TestUow(t *testing.T) {
 	p := &producer{}
-	mgr := uow.NewManager(func(ctx context.Context, keys ...string) (uow.TransactionalDb, error) {
-		if keys[0] == "event" {
-			return NewTransactional(ctx, p), nil
-		}
-		panic("not found")
-	})
+	registry := uow.NewFactoryRegistry(nil).Register(func(ctx context.Context, keys ...string) (uow.TransactionalDb, error) {
+		return NewTransactional(ctx, p), nil
+	}, "event")
+	mgr := uow.NewManager(registry.Resolve)
 	transP := NewTransactionalProducer(p, []string{"event"})
 	err := mgr.WithNew(context.Background(), func(ctx context.Context) error {
 		if err := transP.Send(ctx, NewMessage("1", nil)); err != nil {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/go-saas/uow"
+	"github.com/go-saas/uow/mock"
 	"github.com/mattn/go-sqlite3"
 	sqldblogger "github.com/simukti/sqldb-logger"
 	"github.com/stretchr/testify/assert"
@@ -45,6 +46,15 @@ func TestMain(m *testing.M) {
 		panic(err)
 	}
 
+	err = client.Use(&ReadOnlyGuard{})
+	if err != nil {
+		panic(err)
+	}
+	err = client.Use(&WriteTracker{})
+	if err != nil {
+		panic(err)
+	}
+
 	err = client.AutoMigrate(&post{})
 	if err != nil {
 		panic(err)
@@ -209,3 +219,51 @@ func TestNestedDisable(t *testing.T) {
 	})
 	assert.NoError(t, err)
 }
+
+func TestReadOnly(t *testing.T) {
+	mgr := uow.NewManager(func(ctx context.Context, keys ...string) (uow.TransactionalDb, error) {
+		return NewTransactionDb(client), nil
+	})
+	err := client.Create(&post{gorm.Model{ID: 5001}}).Error
+	assert.NoError(t, err)
+
+	err = mgr.WithNewOpts(context.Background(), func(ctx context.Context) error {
+		p := &post{}
+		err := clientResolver(ctx).Find(p, "id = ?", 5001).Error
+		assert.NoError(t, err)
+		assert.Equal(t, uint(5001), p.ID)
+		return clientResolver(ctx).Create(&post{gorm.Model{ID: 5002}}).Error
+	}, uow.ReadOnly())
+	assert.ErrorIs(t, err, ErrReadOnly)
+
+	//writes are allowed after read-only transaction completes
+	err = client.Create(&post{gorm.Model{ID: 5003}}).Error
+	assert.NoError(t, err)
+}
+
+func TestWriteTracker(t *testing.T) {
+	r := &mock.Recorder{}
+	mgr := uow.NewManager(func(ctx context.Context, keys ...string) (uow.TransactionalDb, error) {
+		return NewTransactionDb(client), nil
+	}, uow.WithReplicaFactory(func(ctx context.Context, keys ...string) (uow.TransactionalDb, error) {
+		return mock.NewTransactionDb("replica", r), nil
+	}))
+
+	err := mgr.WithNew(context.Background(), func(ctx context.Context) error {
+		u, _ := uow.FromCurrentUow(ctx)
+		//reading from primary keeps replica routing
+		err := clientResolver(ctx).WithContext(ctx).Find(&[]post{}).Error
+		assert.NoError(t, err)
+		tx, err := u.GetTxDbRole(ctx, uow.RoleReplica)
+		assert.NoError(t, err)
+		assert.IsType(t, &mock.Txn{}, tx)
+
+		err = clientResolver(ctx).WithContext(ctx).Create(&post{gorm.Model{ID: 6001}}).Error
+		assert.NoError(t, err)
+		tx, err = u.GetTxDbRole(ctx, uow.RoleReplica)
+		assert.NoError(t, err)
+		assert.IsType(t, &TransactionDb{}, tx)
+		return nil
+	})
+	assert.NoError(t, err)
+}
@@ -15,6 +15,8 @@ type (
 
 		commitFunc   CommitFunc
 		rollbackFunc RollbackFunc
+		// readOnlyPool is registered to ReadOnlyGuard until commit or rollback
+		readOnlyPool gorm.ConnPool
 	}
 )
 
@@ -34,6 +36,7 @@ func (t *TransactionDb) Commit() error {
 	if t.commitFunc != nil {
 		return t.commitFunc()
 	}
+	defer t.releaseReadOnly()
 	return t.DB.Commit().Error
 }
 
@@ -41,9 +44,16 @@ func (t *TransactionDb) Rollback() error {
 	if t.rollbackFunc != nil {
 		return t.rollbackFunc()
 	}
+	defer t.releaseReadOnly()
 	return t.DB.Rollback().Error
 }
 
+func (t *TransactionDb) releaseReadOnly() {
+	if t.readOnlyPool != nil {
+		readOnlyPools.Delete(t.readOnlyPool)
+	}
+}
+
 func (t *TransactionDb) Begin(opt ...*sql.TxOptions) (uow.Txn, error) {
 	var err error
 	db := t.DB
@@ -73,6 +83,11 @@ func (t *TransactionDb) Begin(opt ...*sql.TxOptions) (uow.Txn, error) {
 		return ret, nil
 	} else {
 		tx := db.Begin(opt...)
-		return NewTransactionDb(tx), tx.Error
+		ret := NewTransactionDb(tx)
+		if tx.Error == nil && isReadOnly(opt) {
+			ret.readOnlyPool = tx.Statement.ConnPool
+			readOnlyPools.Store(ret.readOnlyPool, struct{}{})
+		}
+		return ret, tx.Error
 	}
 }
@@ -0,0 +1,56 @@
+package gorm
+
+import (
+	"database/sql"
+	"errors"
+	"gorm.io/gorm"
+	"sync"
+)
+
+var (
+	// ErrReadOnly is added by ReadOnlyGuard when writing in a read-only transaction
+	ErrReadOnly = errors.New("can not write in read-only transaction")
+)
+
+// readOnlyPools tracks connection pools of read-only transactions begun by TransactionDb
+var readOnlyPools sync.Map
+
+// ReadOnlyGuard is a gorm.Plugin which rejects create, update and delete in transactions
+// begun by TransactionDb with ReadOnly TxOptions, for databases which do not enforce read-only transaction
+type ReadOnlyGuard struct {
+}
+
+var _ gorm.Plugin = (*ReadOnlyGuard)(nil)
+
+func (g *ReadOnlyGuard) Name() string {
+	return "uow:read_only_guard"
+}
+
+func (g *ReadOnlyGuard) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().Before("gorm:create").Register(g.Name(), guardReadOnly); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register(g.Name(), guardReadOnly); err != nil {
+		return err
+	}
+	return cb.Delete().Before("gorm:delete").Register(g.Name(), guardReadOnly)
+}
+
+func guardReadOnly(db *gorm.DB) {
+	if db.Statement.ConnPool == nil {
+		return
+	}
+	if _, ok := readOnlyPools.Load(db.Statement.ConnPool); ok {
+		_ = db.AddError(ErrReadOnly)
+	}
+}
+
+func isReadOnly(opt []*sql.TxOptions) bool {
+	for _, o := range opt {
+		if o != nil && o.ReadOnly {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package gorm
+
+import (
+	"github.com/go-saas/uow"
+	"gorm.io/gorm"
+)
+
+// WriteTracker is a gorm.Plugin which calls UnitOfWork.MarkWritten before create, update, delete and exec,
+// so that following uow.RoleReplica requests of the unit of work are routed to primary.
+// The unit of work is found from context of statement, see gorm.DB.WithContext
+type WriteTracker struct {
+}
+
+var _ gorm.Plugin = (*WriteTracker)(nil)
+
+func (w *WriteTracker) Name() string {
+	return "uow:write_tracker"
+}
+
+func (w *WriteTracker) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().Before("gorm:create").Register(w.Name(), markWritten); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register(w.Name(), markWritten); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register(w.Name(), markWritten); err != nil {
+		return err
+	}
+	return cb.Raw().Before("gorm:raw").Register(w.Name(), markWritten)
+}
+
+func markWritten(db *gorm.DB) {
+	if db.Statement.Context == nil {
+		return
+	}
+	if u, ok := uow.FromCurrentUow(db.Statement.Context); ok {
+		u.MarkWritten()
+	}
+}
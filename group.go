@@ -0,0 +1,200 @@
+package uow
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// PanicError is recovered from goroutine started by Go or Group
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("goroutine panicked: %v\n%s", e.Value, e.Stack)
+}
+
+// Go run [fn] in a goroutine sharing the current unit of work. The unit of work waits for it before commit,
+// and rolls back if it returns error or panics. Use WithTx to access transactions which are not goroutine-safe.
+// Returns ErrUnitOfWorkNotFound without unit of work, or ErrUnitOfWorkCompleted if the unit of work is not active
+func Go(ctx context.Context, fn func(ctx context.Context) error) error {
+	u, ok := FromCurrentUow(ctx)
+	if !ok {
+		return ErrUnitOfWorkNotFound
+	}
+	return u.goChild(ctx, fn, nil)
+}
+
+func (u *UnitOfWork) goChild(ctx context.Context, fn func(ctx context.Context) error, done func(err error)) error {
+	u.mtx.Lock()
+	if u.state != StateActive {
+		u.mtx.Unlock()
+		return fmt.Errorf("%w: can not start goroutine in state %s", ErrUnitOfWorkCompleted, u.state)
+	}
+	u.children.Add(1)
+	u.mtx.Unlock()
+	//locks held by parent goroutine are not shared
+	ctx = context.WithValue(ctx, heldLocksKey{}, (*heldLock)(nil))
+	go func() {
+		defer u.children.Done()
+		err := runRecover(ctx, fn)
+		if err != nil {
+			u.mtx.Lock()
+			if u.childErr == nil {
+				u.childErr = err
+			}
+			u.mtx.Unlock()
+		}
+		if done != nil {
+			done(err)
+		}
+	}()
+	return nil
+}
+
+// waitChildren wait goroutines started by Go or Group, returns the first error of them
+func (u *UnitOfWork) waitChildren() error {
+	u.children.Wait()
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+	return u.childErr
+}
+
+func runRecover(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return fn(ctx)
+}
+
+// Group is a collection of goroutines sharing the current unit of work, like errgroup.Group.
+// Without unit of work, it works as a plain errgroup which also recovers panics
+type Group struct {
+	ctx context.Context
+	wg  sync.WaitGroup
+	mtx sync.Mutex
+	err error
+}
+
+func NewGroup(ctx context.Context) *Group {
+	return &Group{ctx: ctx}
+}
+
+// Go run [fn] in a goroutine. See Go for unit of work behavior
+func (g *Group) Go(fn func(ctx context.Context) error) {
+	g.wg.Add(1)
+	if u, ok := FromCurrentUow(g.ctx); ok {
+		if err := u.goChild(g.ctx, fn, g.done); err != nil {
+			g.done(err)
+		}
+		return
+	}
+	go func() {
+		g.done(runRecover(g.ctx, fn))
+	}()
+}
+
+func (g *Group) done(err error) {
+	if err != nil {
+		g.mtx.Lock()
+		if g.err == nil {
+			g.err = err
+		}
+		g.mtx.Unlock()
+	}
+	g.wg.Done()
+}
+
+// Wait for all goroutines, returns the first error of them
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	return g.err
+}
+
+// WithTxDb resolve transaction of keys and run [fn] holding its lock,
+// so that goroutines sharing unit of work access the transaction one by one.
+// Locks are reentrant through ctx passed to [fn], so nested WithTxDb or WithTx of the same key, also from joined units of work, runs directly.
+// Goroutines started by Go or Group from that ctx do not inherit held locks
+func (u *UnitOfWork) WithTxDb(ctx context.Context, fn func(ctx context.Context, tx Txn) error, keys ...string) error {
+	tx, err := u.GetTxDb(ctx, keys...)
+	if err != nil {
+		return err
+	}
+	return u.withTxLock(ctx, keys, func(ctx context.Context) error {
+		return fn(ctx, tx)
+	})
+}
+
+// WithTx is WithTxDb of current unit of work with typed transaction
+func WithTx[T any](ctx context.Context, fn func(ctx context.Context, tx T) error, keys ...string) error {
+	u, ok := FromCurrentUow(ctx)
+	if !ok {
+		return ErrUnitOfWorkNotFound
+	}
+	t, err := GetTxFrom[T](ctx, u, keys...)
+	if err != nil {
+		return err
+	}
+	return u.withTxLock(ctx, keys, func(ctx context.Context) error {
+		return fn(ctx, t)
+	})
+}
+
+type heldLocksKey struct{}
+
+// heldLock is a linked list of locks held by ctx
+type heldLock struct {
+	l    *sync.Mutex
+	next *heldLock
+}
+
+func (h *heldLock) holds(l *sync.Mutex) bool {
+	for ; h != nil; h = h.next {
+		if h.l == l {
+			return true
+		}
+	}
+	return false
+}
+
+// withTxLock run [fn] holding lock of the transaction of keys, or directly if ctx already holds it
+func (u *UnitOfWork) withTxLock(ctx context.Context, keys []string, fn func(ctx context.Context) error) error {
+	keys, err := u.resolveKeys(ctx, keys)
+	if err != nil {
+		return err
+	}
+	l := u.txLock(u.formatter(keys...))
+	held, _ := ctx.Value(heldLocksKey{}).(*heldLock)
+	if held.holds(l) {
+		return fn(ctx)
+	}
+	l.Lock()
+	defer l.Unlock()
+	return fn(context.WithValue(ctx, heldLocksKey{}, &heldLock{l: l, next: held}))
+}
+
+// txLock return lock of transaction of formatted key. Locks are kept in the root, as transactions can be shared by joined units of work
+func (u *UnitOfWork) txLock(key string) *sync.Mutex {
+	root := u
+	for root.parent != nil {
+		root = root.parent
+	}
+	root.mtx.Lock()
+	defer root.mtx.Unlock()
+	if root.txLocks == nil {
+		root.txLocks = map[string]*sync.Mutex{}
+	}
+	l, ok := root.txLocks[key]
+	if !ok {
+		l = &sync.Mutex{}
+		root.txLocks[key] = l
+	}
+	return l
+}
@@ -0,0 +1,61 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-saas/uow"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DebugHandler render live units of work of [mgr] from uow.Manager Snapshot, mounted like pprof:
+//
+//	mux.Handle("/debug/uow", http.DebugHandler(mgr))
+//
+// The tree is rendered as text by default, as JSON with query "format=json" or header "Accept: application/json"
+func DebugHandler(mgr uow.Manager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roots := mgr.Snapshot()
+		if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+			if roots == nil {
+				roots = []*uow.UnitSnapshot{}
+			}
+			_ = json.NewEncoder(w).Encode(roots)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		now := time.Now()
+		fmt.Fprintf(w, "%d root unit of work\n", len(roots))
+		for _, s := range roots {
+			writeText(w, s, 0, now)
+		}
+	})
+}
+
+func writeText(w io.Writer, s *uow.UnitSnapshot, depth int, now time.Time) {
+	indent := strings.Repeat("  ", depth)
+	var flags []string
+	if s.Join {
+		flags = append(flags, "join")
+	}
+	if s.ReadOnly {
+		flags = append(flags, "read-only")
+	}
+	if s.RollbackOnly {
+		flags = append(flags, "rollback-only")
+	}
+	fmt.Fprintf(w, "%s%s name=%q state=%s age=%s", indent, s.Id, s.Name, s.State, now.Sub(s.CreatedAt))
+	if len(flags) > 0 {
+		fmt.Fprintf(w, " [%s]", strings.Join(flags, ","))
+	}
+	fmt.Fprintln(w)
+	for _, k := range s.Keys {
+		fmt.Fprintf(w, "%s  - %s began=%s age=%s\n", indent, k.Key, k.BeganAt.Format(time.RFC3339Nano), now.Sub(k.BeganAt))
+	}
+	for _, c := range s.Children {
+		writeText(w, c, depth+1, now)
+	}
+}
@@ -3,6 +3,7 @@ package http
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"github.com/go-saas/uow"
 	"net/http"
 )
@@ -32,7 +33,12 @@ type HandlerFunc func(w http.ResponseWriter, r *http.Request) error
 type option struct {
 	skip       SkipFunc
 	txOpt      []*sql.TxOptions
+	uowOpt     []uow.NewOption
 	errEncoder EncodeErrorFunc
+	// name of unit of work from request, unnamed if nil
+	name func(r *http.Request) string
+	// readOnly run skipped requests in read-only unit of work
+	readOnly bool
 }
 
 type Option func(*option)
@@ -50,6 +56,29 @@ func WithTxOpt(txOpt ...*sql.TxOptions) Option {
 	}
 }
 
+// WithUowOpt forward per-call options to uow.Manager WithNewOpts
+func WithUowOpt(opts ...uow.NewOption) Option {
+	return func(o *option) {
+		o.uowOpt = append(o.uowOpt, opts...)
+	}
+}
+
+// WithNameFunc name unit of work from request, e.g. by the matched route pattern.
+// Name becomes the operation of metrics, so avoid raw paths with ids. default is unnamed
+func WithNameFunc(f func(r *http.Request) string) Option {
+	return func(o *option) {
+		o.name = f
+	}
+}
+
+// WithReadOnlySkipped run skipped requests in a read-only unit of work instead of without unit of work,
+// so that they get a transactional snapshot
+func WithReadOnlySkipped() Option {
+	return func(o *option) {
+		o.readOnly = true
+	}
+}
+
 // WithErrorEncoder error encoder. default will not encode any error
 func WithErrorEncoder(f EncodeErrorFunc) Option {
 	return func(o *option) {
@@ -57,7 +86,7 @@ func WithErrorEncoder(f EncodeErrorFunc) Option {
 	}
 }
 
-// Uow wrap HandlerFunc with unit of work
+// Uow wrap HandlerFunc with unit of work. Respond 503 Service Unavailable if the manager is shutting down
 func Uow(mgr uow.Manager, handler HandlerFunc, opts ...Option) http.Handler {
 	opt := &option{
 		skip: func(r *http.Request) bool {
@@ -71,15 +100,27 @@ func Uow(mgr uow.Manager, handler HandlerFunc, opts ...Option) http.Handler {
 		o(opt)
 	}
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uowOpt := []uow.NewOption{uow.TxOptions(opt.txOpt...)}
+		if opt.name != nil {
+			uowOpt = append(uowOpt, uow.Name(opt.name(r)))
+		}
+		uowOpt = append(uowOpt, opt.uowOpt...)
 		if opt.skip(r) {
-			err := handler(w, r)
-			opt.errEncoder(w, r, err)
-			return
+			if !opt.readOnly {
+				err := handler(w, r)
+				opt.errEncoder(w, r, err)
+				return
+			}
+			uowOpt = append(uowOpt, uow.ReadOnly())
 		}
 		//run into unit of work
-		err := mgr.WithNew(r.Context(), func(ctx context.Context) error {
+		err := mgr.WithNewOpts(r.Context(), func(ctx context.Context) error {
 			return handler(w, r.WithContext(ctx))
-		}, opt.txOpt...)
+		}, uowOpt...)
+		if errors.Is(err, uow.ErrManagerClosed) {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
 		opt.errEncoder(w, r, err)
 		return
 	})
@@ -0,0 +1,28 @@
+package http
+
+import (
+	"context"
+	"github.com/go-saas/uow"
+	"github.com/go-saas/uow/mock"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUowShutdown(t *testing.T) {
+	mgr := uow.NewManager(mock.Factory(mock.NewTransactionDb("a", &mock.Recorder{})))
+	handler := Uow(mgr, func(w http.ResponseWriter, r *http.Request) error {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/orders", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	assert.NoError(t, mgr.Shutdown(context.Background()))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/orders", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
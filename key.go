@@ -0,0 +1,154 @@
+package uow
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var (
+	// ErrUnknownKey is matched by *UnknownKeyError
+	ErrUnknownKey = errors.New("unknown key")
+)
+
+// UnknownKeyError is returned when resolving a key which is not registered by WithKeys in strict mode
+type UnknownKeyError struct {
+	Key string
+}
+
+func (e *UnknownKeyError) Error() string {
+	return fmt.Sprintf("unknown key %s, please register with WithKeys", e.Key)
+}
+
+func (e *UnknownKeyError) Is(target error) bool {
+	return target == ErrUnknownKey
+}
+
+// ResourceKey identifies a transactional resource with its expected transaction type. See Key
+type ResourceKey interface {
+	// Keys passed to KeyFormatter and DbFactory
+	Keys() []string
+	// TxnType is the expected type of transaction
+	TxnType() reflect.Type
+	// TxOptions to begin transaction, nil means not specified
+	TxOptions() []*sql.TxOptions
+}
+
+// Key is a typed handle of transactional resource. T is the expected transaction type, e.g. *gorm.TransactionDb
+type Key[T any] struct {
+	keys  []string
+	txOpt []*sql.TxOptions
+}
+
+var _ ResourceKey = (*Key[Txn])(nil)
+
+// NewKey create a typed key. keys are passed to KeyFormatter and DbFactory as plain string keys
+func NewKey[T any](keys ...string) *Key[T] {
+	return &Key[T]{keys: keys}
+}
+
+// WithTxOptions return a copy of key which begins transaction with [opt]
+func (k *Key[T]) WithTxOptions(opt ...*sql.TxOptions) *Key[T] {
+	return &Key[T]{keys: k.keys, txOpt: opt}
+}
+
+func (k *Key[T]) Keys() []string {
+	return append([]string(nil), k.keys...)
+}
+
+func (k *Key[T]) TxnType() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+func (k *Key[T]) TxOptions() []*sql.TxOptions {
+	return k.txOpt
+}
+
+// String format keys by DefaultKeyFormatter for display. Errors of unit of work use KeyFormatter of Manager
+func (k *Key[T]) String() string {
+	return DefaultKeyFormatter(k.keys...)
+}
+
+// Get resolve transaction from current unit of work
+func (k *Key[T]) Get(ctx context.Context) (T, error) {
+	u, ok := FromCurrentUow(ctx)
+	if !ok {
+		var zero T
+		return zero, ErrUnitOfWorkNotFound
+	}
+	return k.GetFrom(ctx, u)
+}
+
+// GetFrom resolve transaction from unit of work [u]
+func (k *Key[T]) GetFrom(ctx context.Context, u *UnitOfWork) (T, error) {
+	var zero T
+	tx, err := u.GetTxDbKey(ctx, k)
+	if err != nil {
+		return zero, err
+	}
+	return tx.(T), nil
+}
+
+// MustGet is like Get but panics if any error
+func (k *Key[T]) MustGet(ctx context.Context) T {
+	t, err := k.Get(ctx)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// GetTxDbKey resolve transaction of ResourceKey, and check its type
+func (u *UnitOfWork) GetTxDbKey(ctx context.Context, key ResourceKey) (Txn, error) {
+	keys, err := u.resolveKeys(ctx, key.Keys())
+	if err != nil {
+		return nil, err
+	}
+	tx, err := u.getTxDb(ctx, keys, key.TxOptions())
+	if err != nil {
+		return nil, err
+	}
+	if t := reflect.TypeOf(tx); !t.AssignableTo(key.TxnType()) {
+		return nil, &TxnTypeMismatchError{
+			Key:      u.formatter(keys...),
+			Expected: key.TxnType().String(),
+			Actual:   t.String(),
+		}
+	}
+	return tx, nil
+}
+
+// ResolveKey resolve TransactionalDb of ResourceKey
+func (f DbFactory) ResolveKey(ctx context.Context, key ResourceKey) (TransactionalDb, error) {
+	return f(ctx, key.Keys()...)
+}
+
+// WithKeys register keys to Manager. TxOptions of keys are used by GetTxDb with plain string keys as well,
+// and take precedence over WithKeyTxOptions patterns either way.
+// With [strict], resolving unregistered keys fails with ErrUnknownKey
+func WithKeys(strict bool, keys ...ResourceKey) Option {
+	return func(config *Config) {
+		config.keys = append(config.keys, keys...)
+		config.strictKeys = config.strictKeys || strict
+	}
+}
+
+// ValidateKeys resolve each key through [factory], so that misconfigured keys are detected at startup.
+// Keys of errors are formatted by [formatter], which should be the one of Manager. DefaultKeyFormatter if nil
+func ValidateKeys(ctx context.Context, factory DbFactory, formatter KeyFormatter, keys ...ResourceKey) error {
+	if formatter == nil {
+		formatter = DefaultKeyFormatter
+	}
+	var errs []*KeyError
+	for _, key := range keys {
+		if _, err := factory.ResolveKey(ctx, key); err != nil {
+			errs = append(errs, &KeyError{Key: formatter(key.Keys()...), Err: err})
+		}
+	}
+	if len(errs) > 0 {
+		return keyErrors(errs)
+	}
+	return nil
+}
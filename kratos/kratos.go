@@ -3,6 +3,8 @@ package kratos
 import (
 	"context"
 	"database/sql"
+	stderrors "errors"
+	"github.com/go-kratos/kratos/v2/errors"
 	"github.com/go-kratos/kratos/v2/log"
 	"github.com/go-kratos/kratos/v2/middleware"
 	"github.com/go-kratos/kratos/v2/middleware/selector"
@@ -13,6 +15,9 @@ import (
 	"strings"
 )
 
+// ErrReasonManagerClosed is the reason of ServiceUnavailable error returned while uow.Manager is shutting down
+const ErrReasonManagerClosed = "UOW_MANAGER_CLOSED"
+
 func contains(vals []string, s string) bool {
 	for _, v := range vals {
 		if v == s {
@@ -29,7 +34,10 @@ type SkipFunc func(ctx context.Context, req interface{}) bool
 type option struct {
 	skip    SkipFunc
 	txOpt   []*sql.TxOptions
+	uowOpt  []uow.NewOption
 	skipOps []string
+	// readOnly run skipped requests in read-only unit of work
+	readOnly bool
 }
 
 type Option func(*option)
@@ -57,6 +65,21 @@ func WithTxOpt(txOpt ...*sql.TxOptions) Option {
 	}
 }
 
+// WithUowOpt forward per-call options to uow.Manager WithNewOpts
+func WithUowOpt(opts ...uow.NewOption) Option {
+	return func(o *option) {
+		o.uowOpt = append(o.uowOpt, opts...)
+	}
+}
+
+// WithReadOnlySkipped run requests skipped by SkipFunc in a read-only unit of work instead of without unit of work,
+// so that query operations get a transactional snapshot. Operations of WithForceSkipOp are still skipped
+func WithReadOnlySkipped() Option {
+	return func(o *option) {
+		o.readOnly = true
+	}
+}
+
 func DefaultSkip() func(ctx context.Context, req interface{}) bool {
 	return func(ctx context.Context, req interface{}) bool {
 		if t, ok := transport.FromServerContext(ctx); ok {
@@ -79,7 +102,7 @@ func DefaultSkip() func(ctx context.Context, req interface{}) bool {
 	}
 }
 
-// Uow server unit of work middleware
+// Uow server unit of work middleware. Return ServiceUnavailable error if the manager is shutting down
 func Uow(um uow.Manager, opts ...Option) middleware.Middleware {
 	opt := &option{
 		skip: DefaultSkip(),
@@ -89,18 +112,31 @@ func Uow(um uow.Manager, opts ...Option) middleware.Middleware {
 	}
 	return selector.Server(func(next middleware.Handler) middleware.Handler {
 		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			uowOpt := []uow.NewOption{uow.TxOptions(opt.txOpt...)}
+			if t, ok := transport.FromServerContext(ctx); ok {
+				uowOpt = append(uowOpt, uow.Name(t.Operation()))
+			}
+			uowOpt = append(uowOpt, opt.uowOpt...)
 			if opt.skip(ctx, req) {
-				return next(ctx, req)
+				if !opt.readOnly {
+					return next(ctx, req)
+				}
+				log.Debugf("[uow] run into read-only unit of work")
+				uowOpt = append(uowOpt, uow.ReadOnly())
+			} else {
+				log.Debugf("[uow] run into unit of work")
 			}
 			var res interface{}
 			var err error
 			// wrap into new unit of work
-			log.Debugf("[uow] run into unit of work")
-			err = um.WithNew(ctx, func(ctx context.Context) error {
+			err = um.WithNewOpts(ctx, func(ctx context.Context) error {
 				var err error
 				res, err = next(ctx, req)
 				return err
-			})
+			}, uowOpt...)
+			if stderrors.Is(err, uow.ErrManagerClosed) {
+				return nil, errors.ServiceUnavailable(ErrReasonManagerClosed, err.Error()).WithCause(err)
+			}
 			return res, err
 		}
 	}).Match(func(ctx context.Context, operation string) bool {
@@ -0,0 +1,53 @@
+package kratos
+
+import (
+	"context"
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/go-saas/uow"
+	"github.com/go-saas/uow/mock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type fakeTransport struct {
+	operation string
+}
+
+func (t *fakeTransport) Kind() transport.Kind {
+	return transport.KindGRPC
+}
+
+func (t *fakeTransport) Endpoint() string {
+	return ""
+}
+
+func (t *fakeTransport) Operation() string {
+	return t.operation
+}
+
+func (t *fakeTransport) RequestHeader() transport.Header {
+	return nil
+}
+
+func (t *fakeTransport) ReplyHeader() transport.Header {
+	return nil
+}
+
+func TestUowShutdown(t *testing.T) {
+	mgr := uow.NewManager(mock.Factory(mock.NewTransactionDb("a", &mock.Recorder{})))
+	handler := Uow(mgr)(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	})
+
+	ctx := transport.NewServerContext(context.Background(), &fakeTransport{operation: "/order.Order/CreateOrder"})
+	res, err := handler(ctx, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", res)
+
+	assert.NoError(t, mgr.Shutdown(context.Background()))
+	_, err = handler(ctx, nil)
+	assert.True(t, errors.IsServiceUnavailable(err))
+	assert.Equal(t, ErrReasonManagerClosed, errors.Reason(err))
+	assert.ErrorIs(t, err, uow.ErrManagerClosed)
+}
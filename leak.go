@@ -0,0 +1,144 @@
+package uow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrLeakDetectionDisabled is returned by Manager.CheckLeaks without WithLeakDetection
+	ErrLeakDetectionDisabled = errors.New("leak detection is disabled, please enable with WithLeakDetection")
+)
+
+// Leak is a unit of work which is neither committed nor rolled back
+type Leak struct {
+	// Id of unit of work from GetId
+	Id   string
+	Name string
+	// Keys of transactions still open
+	Keys []string
+	// Stack where the unit of work is created
+	Stack   []byte
+	Elapsed time.Duration
+}
+
+func (l *Leak) String() string {
+	return fmt.Sprintf("unit of work %s(%s) open for %s, open keys: [%s]\n%s", l.Id, l.Name, l.Elapsed, strings.Join(l.Keys, ","), l.Stack)
+}
+
+// LeakError is returned by Manager.CheckLeaks
+type LeakError struct {
+	Leaks []*Leak
+}
+
+func (e *LeakError) Error() string {
+	s := make([]string, len(e.Leaks))
+	for i, l := range e.Leaks {
+		s[i] = l.String()
+	}
+	return fmt.Sprintf("%d unit of work leaked:\n%s", len(e.Leaks), strings.Join(s, "\n"))
+}
+
+// WithLeakDetection capture creation stack of units of work, and enable Manager.CheckLeaks to report live ones.
+// It is intended for debugging and tests. default is disabled
+func WithLeakDetection() Option {
+	return func(config *Config) {
+		config.leakDetection = true
+	}
+}
+
+// liveUnits tracks units of work created by Manager until completed
+type liveUnits struct {
+	mtx   sync.Mutex
+	units map[*UnitOfWork]struct{}
+	// idle is closed when there is no live unit of work
+	idle chan struct{}
+}
+
+func newLiveUnits() *liveUnits {
+	idle := make(chan struct{})
+	close(idle)
+	return &liveUnits{units: map[*UnitOfWork]struct{}{}, idle: idle}
+}
+
+func (l *liveUnits) add(u *UnitOfWork) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if len(l.units) == 0 {
+		l.idle = make(chan struct{})
+	}
+	l.units[u] = struct{}{}
+}
+
+func (l *liveUnits) remove(u *UnitOfWork) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if _, ok := l.units[u]; !ok {
+		return
+	}
+	delete(l.units, u)
+	if len(l.units) == 0 {
+		close(l.idle)
+	}
+}
+
+// wait until there is no live unit of work or ctx is done
+func (l *liveUnits) wait(ctx context.Context) error {
+	l.mtx.Lock()
+	idle := l.idle
+	l.mtx.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// list live units of work in order of creation
+func (l *liveUnits) list() []*UnitOfWork {
+	l.mtx.Lock()
+	units := make([]*UnitOfWork, 0, len(l.units))
+	for u := range l.units {
+		units = append(units, u)
+	}
+	l.mtx.Unlock()
+	sort.Slice(units, func(i, j int) bool {
+		return units[i].createdAt.Before(units[j].createdAt)
+	})
+	return units
+}
+
+// finish stop tracking the unit of work once it is committed or rolled back
+func (u *UnitOfWork) finish() {
+	u.unwatchSlow()
+	u.live.remove(u)
+}
+
+// CheckLeaks return *LeakError if any unit of work created by the manager is still open.
+// Returns ErrLeakDetectionDisabled without WithLeakDetection
+func (m *manager) CheckLeaks() error {
+	if !m.cfg.leakDetection {
+		return ErrLeakDetectionDisabled
+	}
+	units := m.live.list()
+	if len(units) == 0 {
+		return nil
+	}
+	leaks := make([]*Leak, len(units))
+	for i, u := range units {
+		leaks[i] = &Leak{
+			Id:      u.id,
+			Name:    u.name,
+			Keys:    u.openKeys(),
+			Stack:   u.stack,
+			Elapsed: time.Since(u.createdAt),
+		}
+	}
+	return &LeakError{Leaks: leaks}
+}
@@ -3,14 +3,35 @@ package uow
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"github.com/google/uuid"
+	"io"
+	"runtime/debug"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Manager interface {
 	CreateNew(ctx context.Context, opt ...*sql.TxOptions) (*UnitOfWork, error)
 	// WithNew create a new unit of work and execute [fn] with this unit of work
 	WithNew(ctx context.Context, fn func(ctx context.Context) error, opt ...*sql.TxOptions) error
+	// WithNewPropagation execute [fn] with unit of work decided by Propagation
+	WithNewPropagation(ctx context.Context, p Propagation, fn func(ctx context.Context) error, opt ...*sql.TxOptions) error
+	// CreateNewOpts create a new unit of work with per-call options
+	CreateNewOpts(ctx context.Context, opts ...NewOption) (*UnitOfWork, error)
+	// WithNewOpts execute [fn] with unit of work configured by per-call options
+	WithNewOpts(ctx context.Context, fn func(ctx context.Context) error, opts ...NewOption) error
+	// Close resources registered by WithCloser, then creating unit of work fails with ErrManagerClosed
+	Close() error
+	// Shutdown wait for in-flight units of work until ctx is done, roll back the remaining ones, then Close
+	Shutdown(ctx context.Context) error
+	// CheckLeaks return *LeakError if any unit of work is neither committed nor rolled back,
+	// or ErrLeakDetectionDisabled without WithLeakDetection
+	CheckLeaks() error
+	// Snapshot return live units of work as trees for debugging
+	Snapshot() []*UnitSnapshot
 }
 
 type KeyFormatter func(keys ...string) string
@@ -30,16 +51,52 @@ var (
 )
 
 type manager struct {
-	cfg     *Config
-	factory DbFactory
+	cfg       *Config
+	factory   DbFactory
+	closeOnce sync.Once
+	closeErr  error
+	// live tracks units of work created by the manager
+	live *liveUnits
+	// closed is set by Shutdown or Close
+	closed int32
 }
 
 var _ Manager = (*manager)(nil)
 
+// CommitMode how a UnitOfWork commits its transactions
+type CommitMode int
+
+const (
+	// CommitModeSequential commit each transaction one by one in reverse order of beginning
+	CommitModeSequential CommitMode = iota
+	// CommitModeTwoPhase prepare every Preparer before committing any of them.
+	// At most one transaction without Preparer is allowed, it will be committed as the last resource
+	CommitModeTwoPhase
+)
+
 type Config struct {
 	DisableNestedTransaction bool
+	CommitMode               CommitMode
 	formatter                KeyFormatter
 	idGen                    IdGenerator
+	retry                    *RetryPolicy
+	keyTxOpt                 []keyTxOptions
+	keys                     []ResourceKey
+	strictKeys               bool
+	// knownKeys formatted from keys in strict mode
+	knownKeys map[string]struct{}
+	// keyOpt TxOptions of keys by formatted key
+	keyOpt    map[string][]*sql.TxOptions
+	closers   []io.Closer
+	enrichers []KeyEnricher
+	// replicaFactory resolves RoleReplica
+	replicaFactory DbFactory
+	tracer         Tracer
+	metrics        Metrics
+	slowThreshold  time.Duration
+	slowFn         SlowFunc
+	leakDetection  bool
+	shutdownGrace  time.Duration
 }
 
 type Option func(*Config)
@@ -49,6 +106,28 @@ func WithDisableNestedNestedTransaction() Option {
 		config.DisableNestedTransaction = true
 	}
 }
+
+// WithCommitMode change how unit of work commits. default is CommitModeSequential
+func WithCommitMode(mode CommitMode) Option {
+	return func(config *Config) {
+		config.CommitMode = mode
+	}
+}
+
+// WithRetryPolicy retry unit of work which fails with retryable error. default is no retry
+func WithRetryPolicy(p *RetryPolicy) Option {
+	return func(config *Config) {
+		config.retry = p
+	}
+}
+
+// WithCloser register resources owned by Manager, e.g. CachingFactory. They are closed in reverse order by Manager.Close
+func WithCloser(closers ...io.Closer) Option {
+	return func(config *Config) {
+		config.closers = append(config.closers, closers...)
+	}
+}
+
 func WithKeyFormatter(f KeyFormatter) Option {
 	return func(config *Config) {
 		config.formatter = f
@@ -65,35 +144,124 @@ func NewManager(factory DbFactory, opts ...Option) Manager {
 	cfg := &Config{
 		formatter: DefaultKeyFormatter,
 		idGen:     DefaultIdGenerator,
+		tracer:    noopTracer{},
+		metrics:   noopMetrics{},
 	}
 	for _, opt := range opts {
 		opt(cfg)
 	}
+	for _, key := range cfg.keys {
+		formatted := cfg.formatter(key.Keys()...)
+		if key.TxOptions() != nil {
+			if cfg.keyOpt == nil {
+				cfg.keyOpt = map[string][]*sql.TxOptions{}
+			}
+			cfg.keyOpt[formatted] = key.TxOptions()
+		}
+		if cfg.strictKeys {
+			if cfg.knownKeys == nil {
+				cfg.knownKeys = map[string]struct{}{}
+			}
+			cfg.knownKeys[formatted] = struct{}{}
+		}
+	}
 	return &manager{
 		cfg:     cfg,
 		factory: factory,
+		live:    newLiveUnits(),
 	}
 }
 
 func (m *manager) CreateNew(ctx context.Context, opt ...*sql.TxOptions) (*UnitOfWork, error) {
-	factory := m.factory
-	//get current for nested
-	var parent *UnitOfWork
-	if current, ok := FromCurrentUow(ctx); ok {
-		parent = current
+	return m.CreateNewOpts(ctx, TxOptions(opt...))
+}
+
+func (m *manager) WithNew(ctx context.Context, fn func(ctx context.Context) error, opt ...*sql.TxOptions) error {
+	return m.WithNewOpts(ctx, fn, TxOptions(opt...))
+}
+
+func (m *manager) WithNewPropagation(ctx context.Context, p Propagation, fn func(ctx context.Context) error, opt ...*sql.TxOptions) error {
+	return m.WithNewOpts(ctx, fn, Propagate(p), TxOptions(opt...))
+}
+
+func (m *manager) CreateNewOpts(ctx context.Context, opts ...NewOption) (*UnitOfWork, error) {
+	u, _, err := m.resolve(ctx, newNewOptions(opts...))
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, ErrUnitOfWorkNotCreated
+	}
+	return u, nil
+}
+
+func (m *manager) WithNewOpts(ctx context.Context, fn func(ctx context.Context) error, opts ...NewOption) error {
+	o := newNewOptions(opts...)
+	if o.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+		defer cancel()
 	}
+	retry := m.cfg.retry
+	if o.retrySet {
+		retry = o.retry
+	}
+	if _, ok := FromCurrentUow(ctx); ok {
+		//never retry nested
+		retry = nil
+	}
+	for attempt := 1; ; attempt++ {
+		u, runCtx, err := m.resolve(ctx, o)
+		if err != nil {
+			return err
+		}
+		if u == nil {
+			return fn(runCtx)
+		}
+		runCtx, span := m.cfg.tracer.Start(runCtx, SpanWithNew, Attribute{Key: AttrId, Value: u.id}, Attribute{Key: AttrName, Value: u.name})
+		//spans of transactions are children of this span
+		u.traceCtx = runCtx
+		err = WithUnitOfWork(runCtx, u, fn)
+		span.End(err)
+		if err == nil || !retry.shouldRetry(attempt, err) {
+			return err
+		}
+		if werr := retry.wait(ctx, attempt); werr != nil {
+			return err
+		}
+	}
+}
+
+func (m *manager) createNew(ctx context.Context, parent *UnitOfWork, join bool, o *newOptions) *UnitOfWork {
+	factory := m.factory
 	if parent != nil {
 		//first level uow will use default factory, others will find from parent
 		factory = nil
 	}
-	uow := newUnitOfWork(m.cfg.idGen(ctx), m.cfg.DisableNestedTransaction, parent, factory, m.cfg.formatter, opt...)
-	return uow, nil
+	u := newUnitOfWork(m.cfg.idGen(ctx), parent, join, factory, m.cfg, o)
+	u.traceCtx = ctx
+	if m.cfg.slowThreshold > 0 || m.cfg.leakDetection {
+		u.stack = debug.Stack()
+	}
+	u.watchSlow()
+	u.live = m.live
+	u.live.add(u)
+	return u
 }
 
-func (m *manager) WithNew(ctx context.Context, fn func(ctx context.Context) error, opt ...*sql.TxOptions) error {
-	uow, err := m.CreateNew(ctx, opt...)
-	if err != nil {
-		return err
-	}
-	return WithUnitOfWork(ctx, uow, fn)
+func (m *manager) Close() error {
+	atomic.StoreInt32(&m.closed, 1)
+	m.closeOnce.Do(func() {
+		var errs []*KeyError
+		for i := len(m.cfg.closers) - 1; i >= 0; i-- {
+			c := m.cfg.closers[i]
+			if err := c.Close(); err != nil {
+				errs = append(errs, &KeyError{Key: fmt.Sprintf("%T", c), Err: err})
+			}
+		}
+		if len(errs) > 0 {
+			m.closeErr = keyErrors(errs)
+		}
+	})
+	return m.closeErr
 }
@@ -0,0 +1,82 @@
+package uow
+
+import "time"
+
+// Outcome of unit of work or the transaction of a key
+type Outcome string
+
+const (
+	// OutcomeCommitted all transactions committed
+	OutcomeCommitted Outcome = "committed"
+	// OutcomeRolledBack rolled back because of error, rollback-only or read-only
+	OutcomeRolledBack Outcome = "rolled_back"
+	// OutcomePanicked fn or goroutines started by Go panicked
+	OutcomePanicked Outcome = "panicked"
+	// OutcomeCommitFailed some transactions failed to commit. See CommitError
+	OutcomeCommitFailed Outcome = "commit_failed"
+	// OutcomeRollbackFailed the transaction of a key failed to roll back
+	OutcomeRollbackFailed Outcome = "rollback_failed"
+)
+
+// Metrics observes unit of work. [name] is the name of unit of work set by NewOption Name, [key] is formatted by KeyFormatter.
+// Methods are called synchronously and should be cheap
+type Metrics interface {
+	// UnitOfWorkCompleted is called by WithCurrentUnitOfWork for root and nested unit of work.
+	// Joined ones are skipped as their transactions are completed by parent.
+	// [elapsed] is the duration of fn and goroutines started by Go
+	UnitOfWorkCompleted(name string, outcome Outcome, elapsed time.Duration)
+	// TxnBegan is called by GetTxDb when beginning the transaction of [key], [err] is not nil if it fails
+	TxnBegan(name, key string, elapsed time.Duration, err error)
+	// TxnCompleted is called when committing or rolling back the transaction of [key]
+	TxnCompleted(name, key string, outcome Outcome, elapsed time.Duration)
+}
+
+// WithMetrics observe outcomes and latencies of unit of work. default is no metrics
+func WithMetrics(m Metrics) Option {
+	return func(config *Config) {
+		config.metrics = m
+	}
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) UnitOfWorkCompleted(name string, outcome Outcome, elapsed time.Duration) {}
+
+func (noopMetrics) TxnBegan(name, key string, elapsed time.Duration, err error) {}
+
+func (noopMetrics) TxnCompleted(name, key string, outcome Outcome, elapsed time.Duration) {}
+
+// outcome of completed unit of work
+func (u *UnitOfWork) outcome(panicked bool) Outcome {
+	if panicked {
+		return OutcomePanicked
+	}
+	switch u.State() {
+	case StateCommitted:
+		return OutcomeCommitted
+	case StateFailed:
+		return OutcomeCommitFailed
+	default:
+		return OutcomeRolledBack
+	}
+}
+
+// observe the transaction of [key] after [fn] of span [name] returns
+func (u *UnitOfWork) observe(name, key string, elapsed time.Duration, err error) {
+	switch name {
+	case SpanBegin:
+		u.metrics.TxnBegan(u.name, key, elapsed, err)
+	case SpanCommit:
+		outcome := OutcomeCommitted
+		if err != nil {
+			outcome = OutcomeCommitFailed
+		}
+		u.metrics.TxnCompleted(u.name, key, outcome, elapsed)
+	case SpanRollback:
+		outcome := OutcomeRolledBack
+		if err != nil {
+			outcome = OutcomeRollbackFailed
+		}
+		u.metrics.TxnCompleted(u.name, key, outcome, elapsed)
+	}
+}
@@ -0,0 +1,43 @@
+package mock
+
+import (
+	"errors"
+	"github.com/go-saas/uow"
+	"testing"
+)
+
+// NoLeaks fail the test if any unit of work created by [mgr] during the test is still open when it finishes.
+// [mgr] must be created with uow.WithLeakDetection, otherwise the test fails immediately
+func NoLeaks(t testing.TB, mgr uow.Manager) {
+	t.Helper()
+	existing := map[string]struct{}{}
+	leaks, err := leaksOf(mgr)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	for _, l := range leaks {
+		existing[l.Id] = struct{}{}
+	}
+	t.Cleanup(func() {
+		leaks, err := leaksOf(mgr)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for _, l := range leaks {
+			if _, ok := existing[l.Id]; !ok {
+				t.Errorf("leaked %s", l)
+			}
+		}
+	})
+}
+
+func leaksOf(mgr uow.Manager) ([]*uow.Leak, error) {
+	err := mgr.CheckLeaks()
+	var leakErr *uow.LeakError
+	if errors.As(err, &leakErr) {
+		return leakErr.Leaks, nil
+	}
+	return nil, err
+}
@@ -1,3 +1,507 @@
 package mock
 
-// TODO
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-saas/uow"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewOptions(t *testing.T) {
+	r := &Recorder{}
+	mgr := uow.NewManager(Factory(NewTransactionDb("a", r)))
+	txOpt := &sql.TxOptions{Isolation: sql.LevelSerializable}
+
+	err := mgr.WithNewOpts(context.Background(), func(ctx context.Context) error {
+		u, _ := uow.FromCurrentUow(ctx)
+		assert.Equal(t, "checkout", u.Name())
+		assert.Equal(t, map[string]string{"team": "orders"}, u.Labels())
+		_, ok := ctx.Deadline()
+		assert.True(t, ok)
+		tx, err := u.GetTxDb(ctx, "a")
+		assert.Equal(t, []*sql.TxOptions{txOpt}, tx.(*Txn).Opt)
+		return err
+	}, uow.Name("checkout"), uow.Labels(map[string]string{"team": "orders"}), uow.Timeout(time.Second), uow.TxOptions(txOpt))
+	assert.NoError(t, err)
+
+	_, err = mgr.CreateNewOpts(context.Background(), uow.Propagate(uow.PropagationNotSupported))
+	assert.ErrorIs(t, err, uow.ErrUnitOfWorkNotCreated)
+}
+
+func TestRetry(t *testing.T) {
+	r := &Recorder{}
+	mgr := uow.NewManager(Factory(NewTransactionDb("a", r)), uow.WithRetryPolicy(&uow.RetryPolicy{MaxAttempts: 3}))
+	retryable := fmt.Errorf("serialization failure: %w", uow.ErrRetryable)
+
+	attempts := 0
+	err := mgr.WithNew(context.Background(), func(ctx context.Context) error {
+		attempts++
+		if err := useDbs(ctx, "a"); err != nil {
+			return err
+		}
+		if attempts < 3 {
+			return retryable
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, []string{"begin a", "rollback a", "begin a", "rollback a", "begin a", "commit a"}, r.Events())
+
+	//nested never retry
+	attempts = 0
+	err = mgr.WithNew(context.Background(), func(ctx context.Context) error {
+		err := mgr.WithNew(ctx, func(ctx context.Context) error {
+			attempts++
+			return retryable
+		})
+		assert.ErrorIs(t, err, uow.ErrRetryable)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, attempts)
+
+	//partial commit never retry
+	r = &Recorder{}
+	a := NewTransactionDb("a", r)
+	a.CommitErr = fmt.Errorf("serialization failure: %w", uow.ErrRetryable)
+	mgr = uow.NewManager(Factory(a, NewTransactionDb("b", r)), uow.WithRetryPolicy(&uow.RetryPolicy{MaxAttempts: 3}))
+	attempts = 0
+	err = mgr.WithNew(context.Background(), func(ctx context.Context) error {
+		attempts++
+		return useDbs(ctx, "a", "b")
+	})
+	var commitErr *uow.CommitError
+	if assert.ErrorAs(t, err, &commitErr) {
+		assert.Equal(t, []string{"b"}, commitErr.Committed)
+	}
+	assert.Equal(t, 1, attempts)
+	assert.Equal(t, []string{"begin a", "begin b", "commit b", "rollback a"}, r.Events())
+}
+
+func TestKeyTxOptions(t *testing.T) {
+	r := &Recorder{}
+	replica := &sql.TxOptions{Isolation: sql.LevelSnapshot, ReadOnly: true}
+	serializable := &sql.TxOptions{Isolation: sql.LevelSerializable}
+	fallback := &sql.TxOptions{}
+	mgr := uow.NewManager(Factory(NewTransactionDb("orders", r), NewTransactionDb("reporting", r), NewTransactionDb("event", r)),
+		uow.WithKeyTxOptions("reporting*", replica))
+
+	err := mgr.WithNewOpts(context.Background(), func(ctx context.Context) error {
+		u, _ := uow.FromCurrentUow(ctx)
+		for key, expect := range map[string]*sql.TxOptions{"orders": serializable, "reporting": replica, "event": fallback} {
+			tx, err := u.GetTxDb(ctx, key)
+			assert.NoError(t, err)
+			assert.Equal(t, []*sql.TxOptions{expect}, tx.(*Txn).Opt, key)
+		}
+		return nil
+	}, uow.KeyTxOptions("orders", serializable), uow.TxOptions(fallback))
+	assert.NoError(t, err)
+}
+
+func TestKey(t *testing.T) {
+	r := &Recorder{}
+	factory := Factory(NewTransactionDb("orders", r), NewTransactionDb("reporting", r))
+	readOnly := &sql.TxOptions{ReadOnly: true}
+	serializable := &sql.TxOptions{Isolation: sql.LevelSerializable}
+	orders := uow.NewKey[*Txn]("orders")
+	reporting := uow.NewKey[*Txn]("reporting").WithTxOptions(readOnly)
+	misTyped := uow.NewKey[*PreparedTxn]("orders")
+	mgr := uow.NewManager(factory, uow.WithKeys(true, orders, reporting), uow.WithKeyTxOptions("*", serializable))
+
+	assert.NoError(t, uow.ValidateKeys(context.Background(), factory, nil, orders, reporting))
+	err := uow.ValidateKeys(context.Background(), factory, func(keys ...string) string {
+		return strings.Join(keys, ":")
+	}, uow.NewKey[*Txn]("oders", "eu"))
+	var keyErr *uow.KeyError
+	if assert.ErrorAs(t, err, &keyErr) {
+		assert.Equal(t, "oders:eu", keyErr.Key)
+	}
+
+	err = mgr.WithNew(context.Background(), func(ctx context.Context) error {
+		tx, err := orders.Get(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []*sql.TxOptions{serializable}, tx.Opt)
+
+		tx, err = uow.GetTx[*Txn](ctx, "reporting")
+		assert.NoError(t, err)
+		assert.Equal(t, []*sql.TxOptions{readOnly}, tx.Opt)
+
+		_, err = misTyped.Get(ctx)
+		assert.ErrorIs(t, err, uow.ErrTxnTypeMismatch)
+
+		_, err = uow.GetTx[*Txn](ctx, "oders")
+		assert.ErrorIs(t, err, uow.ErrUnknownKey)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	//typed key resolves the same TxOptions as its plain string key
+	err = mgr.WithNew(context.Background(), func(ctx context.Context) error {
+		tx, err := reporting.Get(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []*sql.TxOptions{readOnly}, tx.Opt)
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestFactoryRegistry(t *testing.T) {
+	r := &Recorder{}
+	orders, tenant, eu, fallback := NewTransactionDb("orders", r), NewTransactionDb("tenant", r), NewTransactionDb("eu", r), NewTransactionDb("fallback", r)
+	use := func(db *TransactionDb) uow.DbFactory {
+		return func(ctx context.Context, keys ...string) (uow.TransactionalDb, error) {
+			return db, nil
+		}
+	}
+	registry := uow.NewFactoryRegistry(nil).
+		Register(use(orders), "orders").
+		RegisterPrefix(use(tenant), "orders").
+		RegisterPrefix(use(eu), "orders", "eu")
+	ctx := context.Background()
+
+	db, err := registry.Resolve(ctx, "orders")
+	assert.NoError(t, err)
+	assert.Same(t, orders, db)
+	db, err = registry.Resolve(ctx, "orders", "tenant1")
+	assert.NoError(t, err)
+	assert.Same(t, tenant, db)
+	db, err = registry.Resolve(ctx, "orders", "eu", "tenant1")
+	assert.NoError(t, err)
+	assert.Same(t, eu, db)
+	//prefix matches whole key parts
+	_, err = registry.Resolve(ctx, "orders_archive")
+	assert.ErrorIs(t, err, uow.ErrNoFactory)
+	_, err = registry.Resolve(ctx, "unknown")
+	assert.ErrorIs(t, err, uow.ErrNoFactory)
+
+	registry.Fallback(use(fallback))
+	db, err = registry.Resolve(ctx, "unknown")
+	assert.NoError(t, err)
+	assert.Same(t, fallback, db)
+}
+
+func TestCachingFactory(t *testing.T) {
+	r := &Recorder{}
+	resolved := map[string]int{}
+	var evicted []string
+	cache := uow.NewCachingFactory(func(ctx context.Context, keys ...string) (uow.TransactionalDb, error) {
+		resolved[keys[0]]++
+		return NewTransactionDb(keys[0], r), nil
+	}, uow.WithMaxSize(2), uow.WithEvictFunc(func(key string, db uow.TransactionalDb) error {
+		evicted = append(evicted, key)
+		return nil
+	}))
+	mgr := uow.NewManager(cache.Resolve, uow.WithCloser(cache))
+
+	for i := 0; i < 2; i++ {
+		err := mgr.WithNew(context.Background(), func(ctx context.Context) error {
+			return useDbs(ctx, "a", "b")
+		})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, map[string]int{"a": 1, "b": 1}, resolved)
+
+	_, err := cache.Resolve(context.Background(), "c")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, evicted)
+	assert.Equal(t, 2, cache.Len())
+
+	assert.NoError(t, mgr.Close())
+	assert.Equal(t, []string{"a", "b", "c"}, evicted)
+	_, err = cache.Resolve(context.Background(), "a")
+	assert.ErrorIs(t, err, uow.ErrFactoryClosed)
+}
+
+func TestCachingFactoryInUse(t *testing.T) {
+	r := &Recorder{}
+	var block chan struct{}
+	cache := uow.NewCachingFactory(func(ctx context.Context, keys ...string) (uow.TransactionalDb, error) {
+		if block != nil {
+			<-block
+		}
+		return NewTransactionDb(keys[0], r), nil
+	}, uow.WithMaxSize(1), uow.WithEvictFunc(func(key string, db uow.TransactionalDb) error {
+		r.Record("close %s", key)
+		return nil
+	}))
+	mgr := uow.NewManager(cache.Resolve, uow.WithCloser(cache))
+
+	//a is still in use when b exceeds max size
+	err := mgr.WithNew(context.Background(), func(ctx context.Context) error {
+		return useDbs(ctx, "a", "b")
+	})
+	assert.NoError(t, err)
+	//b is evicted once its transaction ends
+	assert.Equal(t, []string{"begin a", "begin b", "commit b", "close b", "commit a"}, r.Events())
+	assert.Equal(t, 1, cache.Len())
+
+	//in use when closing
+	u, err := mgr.CreateNew(context.Background())
+	assert.NoError(t, err)
+	_, err = u.GetTxDb(context.Background(), "a")
+	assert.NoError(t, err)
+
+	block = make(chan struct{})
+	resolved := make(chan error, 1)
+	go func() {
+		_, err := cache.Resolve(context.Background(), "c")
+		resolved <- err
+	}()
+	assert.Eventually(t, func() bool {
+		return cache.Len() == 2
+	}, time.Second, time.Millisecond)
+
+	assert.NoError(t, mgr.Close())
+	assert.NotContains(t, r.Events(), "close a")
+	assert.NoError(t, u.Commit())
+	assert.Contains(t, r.Events(), "close a")
+
+	//resolved after closing
+	close(block)
+	assert.ErrorIs(t, <-resolved, uow.ErrFactoryClosed)
+	assert.Contains(t, r.Events(), "close c")
+
+	//begin from closed cache fails without releasing anything
+	err = uow.NewManager(cache.Resolve).WithNew(context.Background(), func(ctx context.Context) error {
+		return useDbs(ctx, "a")
+	})
+	assert.ErrorIs(t, err, uow.ErrFactoryClosed)
+}
+
+type tenantKey struct{}
+
+func TestKeyEnricher(t *testing.T) {
+	r := &Recorder{}
+	var factoryKeys [][]string
+	mgr := uow.NewManager(func(ctx context.Context, keys ...string) (uow.TransactionalDb, error) {
+		factoryKeys = append(factoryKeys, keys)
+		return NewTransactionDb(uow.DefaultKeyFormatter(keys...), r), nil
+	}, uow.WithKeyEnricher(uow.AppendKeyEnricher(func(ctx context.Context) string {
+		tenant, _ := ctx.Value(tenantKey{}).(string)
+		return tenant
+	})), uow.WithDisableNestedNestedTransaction())
+
+	ctx := context.WithValue(context.Background(), tenantKey{}, "t1")
+	err := mgr.WithNew(ctx, func(ctx context.Context) error {
+		tx, err := uow.GetTx[*Txn](ctx, "orders")
+		assert.NoError(t, err)
+		return mgr.WithNew(ctx, func(ctx context.Context) error {
+			inner, err := uow.GetTx[*Txn](ctx, "orders")
+			assert.Same(t, tx, inner)
+			return err
+		})
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"orders", "t1"}}, factoryKeys)
+	assert.Equal(t, []string{"begin orders/t1", "commit orders/t1"}, r.Events())
+}
+
+func TestSnapshot(t *testing.T) {
+	r := &Recorder{}
+	a, b := NewTransactionDb("a", r), NewTransactionDb("b", r)
+	mgr := uow.NewManager(Factory(a, b))
+
+	var roots []*uow.UnitSnapshot
+	var ids []string
+	err := mgr.WithNewOpts(context.Background(), func(ctx context.Context) error {
+		u, _ := uow.FromCurrentUow(ctx)
+		ids = append(ids, u.GetId())
+		if _, err := u.GetTxDb(ctx, "a"); err != nil {
+			return err
+		}
+		return mgr.WithNewOpts(ctx, func(ctx context.Context) error {
+			u, _ := uow.FromCurrentUow(ctx)
+			ids = append(ids, u.GetId())
+			if _, err := u.GetTxDb(ctx, "b"); err != nil {
+				return err
+			}
+			return mgr.WithNewOpts(ctx, func(ctx context.Context) error {
+				u, _ := uow.FromCurrentUow(ctx)
+				ids = append(ids, u.GetId())
+				u.SetRollbackOnly()
+				roots = mgr.Snapshot()
+				return nil
+			}, uow.Name("joined"), uow.Propagate(uow.PropagationRequired))
+		}, uow.Name("nested"), uow.Propagate(uow.PropagationNested))
+	}, uow.Name("root"), uow.Labels(map[string]string{"tenant": "t1"}))
+	assert.ErrorIs(t, err, uow.ErrRollbackOnly)
+	assert.Empty(t, mgr.Snapshot())
+
+	if !assert.Len(t, roots, 1) {
+		return
+	}
+	root := roots[0]
+	assert.Equal(t, ids[0], root.Id)
+	assert.Equal(t, "root", root.Name)
+	assert.Equal(t, map[string]string{"tenant": "t1"}, root.Labels)
+	assert.Equal(t, uow.StateActive, root.State)
+	if assert.Len(t, root.Keys, 1) {
+		assert.Equal(t, "a", root.Keys[0].Key)
+		assert.False(t, root.Keys[0].BeganAt.IsZero())
+	}
+	if !assert.Len(t, root.Children, 1) {
+		return
+	}
+	nested := root.Children[0]
+	assert.Equal(t, ids[1], nested.Id)
+	assert.Equal(t, ids[0], nested.ParentId)
+	assert.False(t, nested.Join)
+	assert.True(t, nested.RollbackOnly)
+	if assert.Len(t, nested.Keys, 1) {
+		assert.Equal(t, "b", nested.Keys[0].Key)
+	}
+	if !assert.Len(t, nested.Children, 1) {
+		return
+	}
+	joined := nested.Children[0]
+	assert.Equal(t, ids[2], joined.Id)
+	assert.Equal(t, "joined", joined.Name)
+	assert.True(t, joined.Join)
+	assert.Empty(t, joined.Keys)
+	assert.Empty(t, joined.Children)
+
+	data, err := json.Marshal(joined)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"state":"Active"`)
+}
+
+func TestShutdown(t *testing.T) {
+	r := &Recorder{}
+	cache := uow.NewCachingFactory(Factory(NewTransactionDb("a", r), NewTransactionDb("b", r)), uow.WithEvictFunc(func(key string, db uow.TransactionalDb) error {
+		r.Record("close %s", key)
+		return nil
+	}))
+	mgr := uow.NewManager(cache.Resolve, uow.WithCloser(cache))
+
+	started, release := make(chan struct{}), make(chan struct{})
+	inflight := make(chan error, 1)
+	go func() {
+		inflight <- mgr.WithNew(context.Background(), func(ctx context.Context) error {
+			if err := useDbs(ctx, "a"); err != nil {
+				return err
+			}
+			close(started)
+			<-release
+			//nested units of work are still allowed while draining
+			return mgr.WithNew(ctx, func(ctx context.Context) error {
+				return useDbs(ctx, "b")
+			})
+		})
+	}()
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		shutdown <- mgr.Shutdown(ctx)
+	}()
+	assert.Eventually(t, func() bool {
+		_, err := mgr.CreateNew(context.Background())
+		return errors.Is(err, uow.ErrManagerClosed)
+	}, time.Second, time.Millisecond)
+	err := mgr.WithNew(context.Background(), func(ctx context.Context) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, uow.ErrManagerClosed)
+
+	close(release)
+	assert.NoError(t, <-inflight)
+	assert.NoError(t, <-shutdown)
+	assert.Equal(t, []string{"begin a", "begin b", "commit b", "commit a", "close a", "close b"}, r.Events())
+}
+
+func TestShutdownRollback(t *testing.T) {
+	r := &Recorder{}
+	mgr := uow.NewManager(Factory(NewTransactionDb("a", r)))
+
+	straggler, err := mgr.CreateNew(context.Background())
+	assert.NoError(t, err)
+	_, err = straggler.GetTxDb(context.Background(), "a")
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = mgr.Shutdown(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	var shutdownErr *uow.ShutdownError
+	if assert.ErrorAs(t, err, &shutdownErr) {
+		assert.Equal(t, []string{straggler.GetId()}, shutdownErr.RolledBack)
+		assert.Empty(t, shutdownErr.Errs)
+	}
+	assert.Equal(t, uow.StateRolledBack, straggler.State())
+	assert.Equal(t, []string{"begin a", "rollback a"}, r.Events())
+	assert.Empty(t, mgr.Snapshot())
+}
+
+func TestShutdownAbort(t *testing.T) {
+	//stragglers run fn until released, stuck in WithTx
+	run := func(mgr uow.Manager, id chan<- string, release <-chan struct{}) chan error {
+		straggler := make(chan error, 1)
+		go func() {
+			straggler <- mgr.WithNew(context.Background(), func(ctx context.Context) error {
+				return uow.WithTx(ctx, func(ctx context.Context, tx *Txn) error {
+					u, _ := uow.FromCurrentUow(ctx)
+					id <- u.GetId()
+					<-release
+					return nil
+				}, "a")
+			})
+		}()
+		return straggler
+	}
+	shutdown := func(mgr uow.Manager) chan error {
+		shutdown := make(chan error, 1)
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			shutdown <- mgr.Shutdown(ctx)
+		}()
+		return shutdown
+	}
+	assertRolledBack := func(err error, id string) {
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		var shutdownErr *uow.ShutdownError
+		if assert.ErrorAs(t, err, &shutdownErr) {
+			assert.Equal(t, []string{id}, shutdownErr.RolledBack)
+			assert.Empty(t, shutdownErr.Errs)
+		}
+	}
+
+	//rollback waits for the transaction lock within grace period
+	r := &Recorder{}
+	mgr := uow.NewManager(Factory(NewTransactionDb("a", r)), uow.WithShutdownGracePeriod(time.Second))
+	id, release := make(chan string, 1), make(chan struct{})
+	straggler := run(mgr, id, release)
+	straggled := <-id
+	done := shutdown(mgr)
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, []string{"begin a"}, r.Events())
+	close(release)
+	assertRolledBack(<-done, straggled)
+	assert.ErrorIs(t, <-straggler, uow.ErrManagerClosed)
+	assert.Equal(t, []string{"begin a", "rollback a"}, r.Events())
+
+	//stuck transaction is rolled back underneath without grace period
+	r = &Recorder{}
+	mgr = uow.NewManager(Factory(NewTransactionDb("a", r)))
+	release = make(chan struct{})
+	straggler = run(mgr, id, release)
+	straggled = <-id
+	select {
+	case err := <-shutdown(mgr):
+		assertRolledBack(err, straggled)
+	case <-time.After(time.Second):
+		t.Fatal("shutdown blocked by transaction lock")
+	}
+	assert.Equal(t, []string{"begin a", "rollback a"}, r.Events())
+	close(release)
+	assert.ErrorIs(t, <-straggler, uow.ErrManagerClosed)
+}
@@ -0,0 +1,56 @@
+package mock
+
+import (
+	"context"
+	"github.com/go-saas/uow"
+	"sync"
+)
+
+// Span recorded by Tracer
+type Span struct {
+	Name       string
+	Attributes map[string]string
+	// Parent is the span in context when starting, nil if root
+	Parent *Span
+	Err    error
+	Ended  bool
+	tracer *Tracer
+}
+
+var _ uow.Span = (*Span)(nil)
+
+func (s *Span) End(err error) {
+	s.tracer.mtx.Lock()
+	defer s.tracer.mtx.Unlock()
+	s.Err = err
+	s.Ended = true
+}
+
+// Tracer is an in-memory uow.Tracer recording spans in order of starting
+type Tracer struct {
+	mtx   sync.Mutex
+	spans []*Span
+}
+
+var _ uow.Tracer = (*Tracer)(nil)
+
+type spanKey struct{}
+
+func (t *Tracer) Start(ctx context.Context, name string, attrs ...uow.Attribute) (context.Context, uow.Span) {
+	s := &Span{Name: name, Attributes: map[string]string{}, tracer: t}
+	for _, attr := range attrs {
+		s.Attributes[attr.Key] = attr.Value
+	}
+	s.Parent, _ = ctx.Value(spanKey{}).(*Span)
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.spans = append(t.spans, s)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Spans return recorded spans
+func (t *Tracer) Spans() []*Span {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return append([]*Span(nil), t.spans...)
+}
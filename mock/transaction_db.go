@@ -3,22 +3,121 @@ package mock
 import (
 	"context"
 	"database/sql"
-	"log"
+	"fmt"
+	"github.com/go-saas/uow"
+	"sync"
+	"time"
 )
 
-type nonTransactionDb struct {
+// Recorder records calls from TransactionDb and Txn in order
+type Recorder struct {
+	mtx    sync.Mutex
+	events []string
 }
 
-func (n *nonTransactionDb) Begin(ctx context.Context, opt ...*sql.TxOptions) (db interface{}, err error) {
-	return n, nil
+func (r *Recorder) Record(format string, args ...interface{}) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.events = append(r.events, fmt.Sprintf(format, args...))
 }
 
-func (n *nonTransactionDb) Commit() error {
-	log.Println("Commit")
+// Events return a copy of recorded events
+func (r *Recorder) Events() []string {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return append([]string(nil), r.events...)
+}
+
+// TransactionDb is a fake uow.TransactionalDb. Errors can be injected to simulate failures
+type TransactionDb struct {
+	Name     string
+	Recorder *Recorder
+	// TwoPhase makes Begin return *PreparedTxn
+	TwoPhase bool
+	// BeginDelay simulates slow connection
+	BeginDelay time.Duration
+
+	BeginErr    error
+	CommitErr   error
+	RollbackErr error
+	PrepareErr  error
+}
+
+var _ uow.TransactionalDb = (*TransactionDb)(nil)
+
+func NewTransactionDb(name string, r *Recorder) *TransactionDb {
+	return &TransactionDb{Name: name, Recorder: r}
+}
+
+func (d *TransactionDb) Begin(opt ...*sql.TxOptions) (uow.Txn, error) {
+	time.Sleep(d.BeginDelay)
+	if d.BeginErr != nil {
+		return nil, d.BeginErr
+	}
+	d.Recorder.Record("begin %s", d.Name)
+	tx := &Txn{db: d, Opt: opt}
+	if d.TwoPhase {
+		return &PreparedTxn{Txn: tx}, nil
+	}
+	return tx, nil
+}
+
+// Factory returns a uow.DbFactory which resolves dbs by the first key
+func Factory(dbs ...*TransactionDb) uow.DbFactory {
+	return func(ctx context.Context, keys ...string) (uow.TransactionalDb, error) {
+		for _, db := range dbs {
+			if len(keys) > 0 && db.Name == keys[0] {
+				return db, nil
+			}
+		}
+		return nil, fmt.Errorf("db %v not found", keys)
+	}
+}
+
+type Txn struct {
+	db  *TransactionDb
+	Opt []*sql.TxOptions
+}
+
+var _ uow.Txn = (*Txn)(nil)
+
+func (t *Txn) Commit() error {
+	if t.db.CommitErr != nil {
+		return t.db.CommitErr
+	}
+	t.db.Recorder.Record("commit %s", t.db.Name)
+	return nil
+}
+
+func (t *Txn) Rollback() error {
+	if t.db.RollbackErr != nil {
+		return t.db.RollbackErr
+	}
+	t.db.Recorder.Record("rollback %s", t.db.Name)
+	return nil
+}
+
+// PreparedTxn is a Txn which supports two-phase commit
+type PreparedTxn struct {
+	*Txn
+}
+
+var _ uow.Preparer = (*PreparedTxn)(nil)
+
+func (t *PreparedTxn) Prepare() error {
+	if t.db.PrepareErr != nil {
+		return t.db.PrepareErr
+	}
+	t.db.Recorder.Record("prepare %s", t.db.Name)
+	return nil
+}
+
+func (t *PreparedTxn) CommitPrepared() error {
+	t.db.Recorder.Record("commit prepared %s", t.db.Name)
 	return nil
 }
 
-func (n *nonTransactionDb) Rollback() error {
-	log.Println("Rollback")
+func (t *PreparedTxn) RollbackPrepared() error {
+	t.db.Recorder.Record("rollback prepared %s", t.db.Name)
 	return nil
 }
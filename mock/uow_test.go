@@ -1,3 +1,702 @@
 package mock
 
-// TODO
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/go-saas/uow"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func useDbs(ctx context.Context, keys ...string) error {
+	u, ok := uow.FromCurrentUow(ctx)
+	if !ok {
+		return uow.ErrUnitOfWorkNotFound
+	}
+	for _, key := range keys {
+		if _, err := u.GetTxDb(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestTwoPhaseCommit(t *testing.T) {
+	r := &Recorder{}
+	a, b, c := NewTransactionDb("a", r), NewTransactionDb("b", r), NewTransactionDb("c", r)
+	a.TwoPhase, b.TwoPhase = true, true
+	mgr := uow.NewManager(Factory(a, b, c), uow.WithCommitMode(uow.CommitModeTwoPhase))
+
+	err := mgr.WithNew(context.Background(), func(ctx context.Context) error {
+		return useDbs(ctx, "a", "b", "c")
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"begin a", "begin b", "begin c",
+		"prepare b", "prepare a",
+		"commit c",
+		"commit prepared b", "commit prepared a",
+	}, r.Events())
+}
+
+func TestTwoPhaseCommitPrepareFail(t *testing.T) {
+	r := &Recorder{}
+	a, b, c := NewTransactionDb("a", r), NewTransactionDb("b", r), NewTransactionDb("c", r)
+	a.TwoPhase, b.TwoPhase = true, true
+	a.PrepareErr = errors.New("prepare a")
+	mgr := uow.NewManager(Factory(a, b, c), uow.WithCommitMode(uow.CommitModeTwoPhase))
+
+	err := mgr.WithNew(context.Background(), func(ctx context.Context) error {
+		return useDbs(ctx, "a", "b", "c")
+	})
+	assert.ErrorIs(t, err, a.PrepareErr)
+	assert.Equal(t, []string{
+		"begin a", "begin b", "begin c",
+		"prepare b",
+		"rollback prepared b",
+		"rollback c", "rollback a",
+	}, r.Events())
+}
+
+func TestTwoPhaseCommitMultipleLastResource(t *testing.T) {
+	r := &Recorder{}
+	a, b := NewTransactionDb("a", r), NewTransactionDb("b", r)
+	mgr := uow.NewManager(Factory(a, b), uow.WithCommitMode(uow.CommitModeTwoPhase))
+
+	err := mgr.WithNew(context.Background(), func(ctx context.Context) error {
+		return useDbs(ctx, "a", "b")
+	})
+	assert.ErrorIs(t, err, uow.ErrMultipleLastResource)
+}
+
+func TestCommitError(t *testing.T) {
+	r := &Recorder{}
+	a, b, c := NewTransactionDb("a", r), NewTransactionDb("b", r), NewTransactionDb("c", r)
+	b.CommitErr = errors.New("commit b")
+	a.RollbackErr = errors.New("rollback a")
+	mgr := uow.NewManager(Factory(a, b, c))
+
+	err := mgr.WithNew(context.Background(), func(ctx context.Context) error {
+		return useDbs(ctx, "a", "b", "c")
+	})
+	var commitErr *uow.CommitError
+	if assert.ErrorAs(t, err, &commitErr) {
+		assert.Equal(t, []string{"c"}, commitErr.Committed)
+		assert.Equal(t, []string{"b"}, commitErr.Failed)
+		assert.Equal(t, []string{"a"}, commitErr.Skipped)
+	}
+	assert.ErrorIs(t, err, b.CommitErr)
+
+	var rollbackErr *uow.RollbackError
+	if assert.ErrorAs(t, err, &rollbackErr) {
+		assert.Len(t, rollbackErr.Errs, 1)
+		assert.Equal(t, "a", rollbackErr.Errs[0].Key)
+	}
+	assert.ErrorIs(t, err, a.RollbackErr)
+}
+
+func TestCallbacks(t *testing.T) {
+	r := &Recorder{}
+	mgr := uow.NewManager(Factory(NewTransactionDb("a", r)))
+	fakeErr := errors.New("fake")
+
+	var events []string
+	register := func(ctx context.Context, name string) {
+		u, _ := uow.FromCurrentUow(ctx)
+		u.OnCommitted(func(ctx context.Context) {
+			events = append(events, "committed "+name)
+		})
+		u.OnRolledBack(func(ctx context.Context, err error) {
+			events = append(events, "rolled back "+name)
+		})
+		u.OnCompleted(func(ctx context.Context, err error) {
+			events = append(events, "completed "+name)
+		})
+	}
+
+	err := mgr.WithNew(context.Background(), func(ctx context.Context) error {
+		register(ctx, "outer")
+		err := mgr.WithNew(ctx, func(ctx context.Context) error {
+			register(ctx, "inner")
+			return nil
+		})
+		assert.NoError(t, err)
+		//inner callbacks wait for outer
+		assert.Empty(t, events)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"committed outer", "committed inner", "completed outer", "completed inner"}, events)
+
+	events = nil
+	err = mgr.WithNew(context.Background(), func(ctx context.Context) error {
+		register(ctx, "outer")
+		err := mgr.WithNew(ctx, func(ctx context.Context) error {
+			register(ctx, "inner")
+			return fakeErr
+		})
+		assert.ErrorIs(t, err, fakeErr)
+		assert.Equal(t, []string{"rolled back inner", "completed inner"}, events)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"rolled back inner", "completed inner", "committed outer", "completed outer"}, events)
+}
+
+func TestPropagation(t *testing.T) {
+	r := &Recorder{}
+	mgr := uow.NewManager(Factory(NewTransactionDb("orders", r), NewTransactionDb("audit", r)))
+	fakeErr := errors.New("fake")
+
+	err := mgr.WithNew(context.Background(), func(ctx context.Context) error {
+		outer, _ := uow.FromCurrentUow(ctx)
+		outerTx, err := outer.GetTxDb(ctx, "orders")
+		assert.NoError(t, err)
+
+		//join current
+		err = mgr.WithNewPropagation(ctx, uow.PropagationRequired, func(ctx context.Context) error {
+			inner, _ := uow.FromCurrentUow(ctx)
+			assert.NotEqual(t, outer.GetId(), inner.GetId())
+			tx, err := inner.GetTxDb(ctx, "orders")
+			assert.Same(t, outerTx, tx)
+			return err
+		})
+		assert.NoError(t, err)
+
+		//independent unit of work survives outer rollback
+		err = mgr.WithNewPropagation(ctx, uow.PropagationRequiresNew, func(ctx context.Context) error {
+			return useDbs(ctx, "audit")
+		})
+		assert.NoError(t, err)
+
+		err = mgr.WithNewPropagation(ctx, uow.PropagationNotSupported, func(ctx context.Context) error {
+			_, ok := uow.FromCurrentUow(ctx)
+			assert.False(t, ok)
+			return nil
+		})
+		assert.NoError(t, err)
+
+		err = mgr.WithNewPropagation(ctx, uow.PropagationNever, func(ctx context.Context) error {
+			return nil
+		})
+		assert.ErrorIs(t, err, uow.ErrUnitOfWorkExists)
+		return fakeErr
+	})
+	assert.ErrorIs(t, err, fakeErr)
+	assert.Equal(t, []string{"begin orders", "begin audit", "commit audit", "rollback orders"}, r.Events())
+
+	err = mgr.WithNewPropagation(context.Background(), uow.PropagationMandatory, func(ctx context.Context) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, uow.ErrUnitOfWorkNotFound)
+
+	err = mgr.WithNewPropagation(context.Background(), uow.PropagationSupports, func(ctx context.Context) error {
+		_, ok := uow.FromCurrentUow(ctx)
+		assert.False(t, ok)
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestContextDone(t *testing.T) {
+	r := &Recorder{}
+	mgr := uow.NewManager(Factory(NewTransactionDb("a", r)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	err := mgr.WithNew(ctx, func(ctx context.Context) error {
+		if err := useDbs(ctx, "a"); err != nil {
+			return err
+		}
+		<-ctx.Done()
+		return nil
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, []string{"begin a", "rollback a"}, r.Events())
+}
+
+func TestState(t *testing.T) {
+	r := &Recorder{}
+	mgr := uow.NewManager(Factory(NewTransactionDb("a", r)))
+	ctx := context.Background()
+
+	u, err := mgr.CreateNew(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uow.StateActive, u.State())
+	_, err = u.GetTxDb(ctx, "a")
+	assert.NoError(t, err)
+	assert.NoError(t, u.Commit())
+	assert.Equal(t, uow.StateCommitted, u.State())
+
+	_, err = u.GetTxDb(ctx, "a")
+	assert.ErrorIs(t, err, uow.ErrUnitOfWorkCompleted)
+	assert.ErrorIs(t, u.Commit(), uow.ErrUnitOfWorkCompleted)
+	assert.ErrorIs(t, u.Rollback(), uow.ErrUnitOfWorkCompleted)
+
+	u, _ = mgr.CreateNew(ctx)
+	assert.NoError(t, u.Rollback())
+	assert.Equal(t, uow.StateRolledBack, u.State())
+	assert.ErrorIs(t, u.Commit(), uow.ErrUnitOfWorkCompleted)
+	//error is kept if unit of work is finished inside fn
+	fnErr := errors.New("fn")
+	err = mgr.WithNew(ctx, func(ctx context.Context) error {
+		u, _ := uow.FromCurrentUow(ctx)
+		if err := u.Commit(); err != nil {
+			return err
+		}
+		return fnErr
+	})
+	assert.Equal(t, fnErr, err)
+}
+
+func TestRollbackOnly(t *testing.T) {
+	r := &Recorder{}
+	mgr := uow.NewManager(Factory(NewTransactionDb("a", r)), uow.WithDisableNestedNestedTransaction())
+	fakeErr := errors.New("fake")
+
+	err := mgr.WithNew(context.Background(), func(ctx context.Context) error {
+		if err := useDbs(ctx, "a"); err != nil {
+			return err
+		}
+		err := mgr.WithNew(ctx, func(ctx context.Context) error {
+			if err := useDbs(ctx, "a"); err != nil {
+				return err
+			}
+			return fakeErr
+		})
+		assert.ErrorIs(t, err, fakeErr)
+		//swallow inner error
+		u, _ := uow.FromCurrentUow(ctx)
+		assert.True(t, u.IsRollbackOnly())
+		return nil
+	})
+	assert.ErrorIs(t, err, uow.ErrRollbackOnly)
+	assert.Equal(t, []string{"begin a", "rollback a"}, r.Events())
+}
+
+func TestGetTx(t *testing.T) {
+	r := &Recorder{}
+	mgr := uow.NewManager(Factory(NewTransactionDb("a", r)))
+
+	_, err := uow.GetTx[*Txn](context.Background(), "a")
+	assert.ErrorIs(t, err, uow.ErrUnitOfWorkNotFound)
+
+	err = mgr.WithNew(context.Background(), func(ctx context.Context) error {
+		tx, err := uow.GetTx[*Txn](ctx, "a")
+		assert.NoError(t, err)
+		assert.NotNil(t, tx)
+
+		_, err = uow.GetTx[*PreparedTxn](ctx, "a")
+		var mismatch *uow.TxnTypeMismatchError
+		if assert.ErrorAs(t, err, &mismatch) {
+			assert.Equal(t, "*mock.PreparedTxn", mismatch.Expected)
+			assert.Equal(t, "*mock.Txn", mismatch.Actual)
+		}
+		assert.ErrorIs(t, err, uow.ErrTxnTypeMismatch)
+		assert.Panics(t, func() {
+			uow.MustGetTx[*PreparedTxn](ctx, "a")
+		})
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestReplicaRouting(t *testing.T) {
+	r := &Recorder{}
+	primary, replica := NewTransactionDb("primary", r), NewTransactionDb("replica", r)
+	mgr := uow.NewManager(Factory(primary), uow.WithReplicaFactory(func(ctx context.Context, keys ...string) (uow.TransactionalDb, error) {
+		return replica, nil
+	}))
+
+	err := mgr.WithNew(context.Background(), func(ctx context.Context) error {
+		u, _ := uow.FromCurrentUow(ctx)
+		readTx, err := u.GetTxDbRole(ctx, uow.RoleReplica, "primary")
+		assert.NoError(t, err)
+		assert.Equal(t, []*sql.TxOptions{{ReadOnly: true}}, readTx.(*Txn).Opt)
+
+		writeTx, err := u.GetTxDbRole(ctx, uow.RolePrimary, "primary")
+		assert.NoError(t, err)
+		assert.NotSame(t, readTx, writeTx)
+
+		//reading from primary keeps routing
+		tx, err := u.GetTxDbRole(ctx, uow.RoleReplica, "primary")
+		assert.NoError(t, err)
+		assert.Same(t, readTx, tx)
+
+		//fail closed after write
+		u.MarkWritten()
+		tx, err = u.GetTxDbRole(ctx, uow.RoleReplica, "primary")
+		assert.Same(t, writeTx, tx)
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"begin replica", "begin primary", "commit primary", "commit replica"}, r.Events())
+}
+
+func TestReadOnly(t *testing.T) {
+	r := &Recorder{}
+	mgr := uow.NewManager(Factory(NewTransactionDb("a", r)))
+
+	err := mgr.WithNewOpts(context.Background(), func(ctx context.Context) error {
+		tx, err := uow.GetTx[*Txn](ctx, "a")
+		assert.Equal(t, []*sql.TxOptions{{ReadOnly: true, Isolation: sql.LevelSnapshot}}, tx.Opt)
+		return err
+	}, uow.ReadOnly(), uow.TxOptions(&sql.TxOptions{Isolation: sql.LevelSnapshot}))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"begin a", "rollback a"}, r.Events())
+
+	//rollback is not retried after read-only commit fails to roll back
+	b := NewTransactionDb("b", r)
+	b.RollbackErr = errors.New("rollback b")
+	mgr = uow.NewManager(Factory(b))
+	err = mgr.WithNewOpts(context.Background(), func(ctx context.Context) error {
+		return useDbs(ctx, "b")
+	}, uow.ReadOnly())
+	assert.ErrorIs(t, err, b.RollbackErr)
+	assert.NotErrorIs(t, err, uow.ErrUnitOfWorkCompleted)
+}
+
+func TestConcurrentGetTxDb(t *testing.T) {
+	r := &Recorder{}
+	a, b := NewTransactionDb("a", r), NewTransactionDb("b", r)
+	//both keys must be resolving at the same time to pass the barrier
+	var arrived sync.WaitGroup
+	arrived.Add(2)
+	barrier := make(chan struct{})
+	go func() {
+		arrived.Wait()
+		close(barrier)
+	}()
+	factory := Factory(a, b)
+	mgr := uow.NewManager(func(ctx context.Context, keys ...string) (uow.TransactionalDb, error) {
+		arrived.Done()
+		select {
+		case <-barrier:
+		case <-time.After(time.Second):
+			t.Error("different keys do not begin in parallel")
+		}
+		return factory(ctx, keys...)
+	})
+
+	err := mgr.WithNew(context.Background(), func(ctx context.Context) error {
+		var wg sync.WaitGroup
+		txs := make([]uow.Txn, 6)
+		for i := range txs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				u, _ := uow.FromCurrentUow(ctx)
+				tx, err := u.GetTxDb(ctx, []string{"a", "b"}[i%2])
+				assert.NoError(t, err)
+				txs[i] = tx
+			}(i)
+		}
+		wg.Wait()
+		for i := 2; i < len(txs); i++ {
+			assert.Same(t, txs[i%2], txs[i])
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	events := r.Events()
+	assert.ElementsMatch(t, []string{"begin a", "begin b"}, events[:2])
+	assert.Len(t, events, 4)
+}
+
+func TestGroup(t *testing.T) {
+	r := &Recorder{}
+	mgr := uow.NewManager(Factory(NewTransactionDb("a", r)))
+	fakeErr := errors.New("fake")
+
+	var count int
+	err := mgr.WithNew(context.Background(), func(ctx context.Context) error {
+		g := uow.NewGroup(ctx)
+		for i := 0; i < 10; i++ {
+			g.Go(func(ctx context.Context) error {
+				return uow.WithTx(ctx, func(ctx context.Context, tx *Txn) error {
+					//serialized by WithTx
+					count++
+					//nested is reentrant, also from joined unit of work
+					return mgr.WithNewPropagation(ctx, uow.PropagationRequired, func(ctx context.Context) error {
+						return uow.WithTx(ctx, func(ctx context.Context, tx *Txn) error {
+							count++
+							return nil
+						}, "a")
+					})
+				}, "a")
+			})
+		}
+		return g.Wait()
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 20, count)
+	assert.Equal(t, []string{"begin a", "commit a"}, r.Events())
+
+	//parent waits for children, and rolls back on child error
+	r = &Recorder{}
+	mgr = uow.NewManager(Factory(NewTransactionDb("a", r)))
+	err = mgr.WithNew(context.Background(), func(ctx context.Context) error {
+		assert.NoError(t, uow.Go(ctx, func(ctx context.Context) error {
+			time.Sleep(10 * time.Millisecond)
+			if err := useDbs(ctx, "a"); err != nil {
+				return err
+			}
+			return fakeErr
+		}))
+		return nil
+	})
+	assert.ErrorIs(t, err, fakeErr)
+	assert.Equal(t, []string{"begin a", "rollback a"}, r.Events())
+
+	err = mgr.WithNew(context.Background(), func(ctx context.Context) error {
+		return uow.Go(ctx, func(ctx context.Context) error {
+			panic("child")
+		})
+	})
+	var panicErr *uow.PanicError
+	if assert.ErrorAs(t, err, &panicErr) {
+		assert.Equal(t, "child", panicErr.Value)
+	}
+
+	//goroutines do not inherit held locks
+	var order []string
+	err = mgr.WithNew(context.Background(), func(ctx context.Context) error {
+		return uow.WithTx(ctx, func(ctx context.Context, tx *Txn) error {
+			if err := uow.Go(ctx, func(ctx context.Context) error {
+				return uow.WithTx(ctx, func(ctx context.Context, tx *Txn) error {
+					order = append(order, "child")
+					return nil
+				}, "a")
+			}); err != nil {
+				return err
+			}
+			time.Sleep(10 * time.Millisecond)
+			order = append(order, "parent")
+			return nil
+		}, "a")
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"parent", "child"}, order)
+
+	//transactions are not required to be comparable
+	mgr = uow.NewManager(func(ctx context.Context, keys ...string) (uow.TransactionalDb, error) {
+		return sliceDb{}, nil
+	})
+	err = mgr.WithNew(context.Background(), func(ctx context.Context) error {
+		return uow.WithTx(ctx, func(ctx context.Context, tx sliceTxn) error {
+			return nil
+		}, "a")
+	})
+	assert.NoError(t, err)
+}
+
+type sliceDb struct{}
+
+func (sliceDb) Begin(opt ...*sql.TxOptions) (uow.Txn, error) {
+	return sliceTxn{opt: opt}, nil
+}
+
+// sliceTxn can not be used as map key
+type sliceTxn struct {
+	opt []*sql.TxOptions
+}
+
+func (sliceTxn) Commit() error { return nil }
+
+func (sliceTxn) Rollback() error { return nil }
+
+func TestTracer(t *testing.T) {
+	r := &Recorder{}
+	a, b := NewTransactionDb("a", r), NewTransactionDb("b", r)
+	b.CommitErr = errors.New("commit b")
+	tracer := &Tracer{}
+	mgr := uow.NewManager(Factory(a, b), uow.WithTracer(tracer))
+
+	var outerId, innerId string
+	err := mgr.WithNewOpts(context.Background(), func(ctx context.Context) error {
+		u, _ := uow.FromCurrentUow(ctx)
+		outerId = u.GetId()
+		if err := useDbs(ctx, "a"); err != nil {
+			return err
+		}
+		return mgr.WithNewOpts(ctx, func(ctx context.Context) error {
+			u, _ := uow.FromCurrentUow(ctx)
+			innerId = u.GetId()
+			return useDbs(ctx, "b")
+		}, uow.Name("inner"), uow.Propagate(uow.PropagationNested))
+	}, uow.Name("outer"))
+	assert.Error(t, err)
+
+	spans := tracer.Spans()
+	var names []string
+	for _, s := range spans {
+		names = append(names, s.Name)
+		assert.True(t, s.Ended)
+	}
+	assert.Equal(t, []string{
+		uow.SpanWithNew, uow.SpanBegin,
+		uow.SpanWithNew, uow.SpanBegin, uow.SpanCommit,
+		uow.SpanRollback, uow.SpanRollback,
+	}, names)
+
+	outer, beginA, inner, beginB, commitB, rollbackB, rollbackA := spans[0], spans[1], spans[2], spans[3], spans[4], spans[5], spans[6]
+	assert.Nil(t, outer.Parent)
+	assert.Equal(t, map[string]string{uow.AttrId: outerId, uow.AttrName: "outer"}, outer.Attributes)
+	assert.Error(t, outer.Err)
+
+	assert.Equal(t, outer, beginA.Parent)
+	assert.Equal(t, map[string]string{uow.AttrId: outerId, uow.AttrKey: "a"}, beginA.Attributes)
+	assert.Equal(t, outer, rollbackA.Parent)
+
+	assert.Equal(t, outer, inner.Parent)
+	assert.Equal(t, "inner", inner.Attributes[uow.AttrName])
+	for _, s := range []*Span{beginB, commitB, rollbackB} {
+		assert.Equal(t, inner, s.Parent)
+		assert.Equal(t, map[string]string{uow.AttrId: innerId, uow.AttrKey: "b"}, s.Attributes)
+	}
+	assert.Equal(t, b.CommitErr, commitB.Err)
+	assert.NoError(t, rollbackB.Err)
+}
+
+func TestSlowThreshold(t *testing.T) {
+	r := &Recorder{}
+	a, b := NewTransactionDb("a", r), NewTransactionDb("b", r)
+	var mtx sync.Mutex
+	var reports []*uow.SlowReport
+	mgr := uow.NewManager(Factory(a, b), uow.WithSlowThreshold(30*time.Millisecond, func(r *uow.SlowReport) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		reports = append(reports, r)
+	}))
+
+	var id string
+	err := mgr.WithNewOpts(context.Background(), func(ctx context.Context) error {
+		u, _ := uow.FromCurrentUow(ctx)
+		id = u.GetId()
+		if err := useDbs(ctx, "a"); err != nil {
+			return err
+		}
+		time.Sleep(20 * time.Millisecond)
+		if err := useDbs(ctx, "b"); err != nil {
+			return err
+		}
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}, uow.Name("slow"))
+	assert.NoError(t, err)
+
+	//fast unit of work is never reported
+	assert.NoError(t, mgr.WithNew(context.Background(), func(ctx context.Context) error {
+		return useDbs(ctx, "a", "b")
+	}))
+	time.Sleep(50 * time.Millisecond)
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	if !assert.Len(t, reports, 2) {
+		return
+	}
+	//unit of work and key a, b is committed before reaching threshold
+	assert.ElementsMatch(t, []string{"", "a"}, []string{reports[0].Key, reports[1].Key})
+	for _, report := range reports {
+		assert.Equal(t, id, report.Id)
+		assert.Equal(t, "slow", report.Name)
+		assert.Equal(t, []string{"a", "b"}, report.Keys)
+		assert.GreaterOrEqual(t, report.Elapsed, 30*time.Millisecond)
+		assert.Contains(t, string(report.Stack), "TestSlowThreshold")
+	}
+}
+
+func TestCheckLeaks(t *testing.T) {
+	r := &Recorder{}
+	a := NewTransactionDb("a", r)
+	mgr := uow.NewManager(Factory(a), uow.WithLeakDetection())
+
+	leaked, err := mgr.CreateNewOpts(context.Background(), uow.Name("leaked"))
+	assert.NoError(t, err)
+	_, err = leaked.GetTxDb(context.Background(), "a")
+	assert.NoError(t, err)
+
+	t.Run("NoLeaks", func(t *testing.T) {
+		NoLeaks(t, mgr)
+		assert.NoError(t, mgr.WithNew(context.Background(), func(ctx context.Context) error {
+			return useDbs(ctx, "a")
+		}))
+		u, err := mgr.CreateNew(context.Background())
+		assert.NoError(t, err)
+		assert.NoError(t, u.Rollback())
+	})
+
+	err = mgr.CheckLeaks()
+	var leakErr *uow.LeakError
+	if assert.ErrorAs(t, err, &leakErr) {
+		assert.Len(t, leakErr.Leaks, 1)
+		leak := leakErr.Leaks[0]
+		assert.Equal(t, leaked.GetId(), leak.Id)
+		assert.Equal(t, "leaked", leak.Name)
+		assert.Equal(t, []string{"a"}, leak.Keys)
+		assert.Contains(t, string(leak.Stack), "TestCheckLeaks")
+	}
+
+	assert.NoError(t, leaked.Commit())
+	assert.NoError(t, mgr.CheckLeaks())
+	assert.ErrorIs(t, uow.NewManager(Factory(a)).CheckLeaks(), uow.ErrLeakDetectionDisabled)
+}
+
+// fakeTB records failures of test helpers
+type fakeTB struct {
+	testing.TB
+	failures []string
+	cleanups []func()
+}
+
+func (f *fakeTB) Helper() {}
+
+func (f *fakeTB) Error(args ...interface{}) {
+	f.failures = append(f.failures, fmt.Sprint(args...))
+}
+
+func (f *fakeTB) Errorf(format string, args ...interface{}) {
+	f.failures = append(f.failures, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeTB) Fatal(args ...interface{}) {
+	f.failures = append(f.failures, fmt.Sprint(args...))
+}
+
+func (f *fakeTB) Cleanup(fn func()) {
+	f.cleanups = append(f.cleanups, fn)
+}
+
+func (f *fakeTB) finish() {
+	for i := len(f.cleanups) - 1; i >= 0; i-- {
+		f.cleanups[i]()
+	}
+}
+
+func TestNoLeaks(t *testing.T) {
+	mgr := uow.NewManager(Factory(NewTransactionDb("a", &Recorder{})), uow.WithLeakDetection())
+	existing, err := mgr.CreateNew(context.Background())
+	assert.NoError(t, err)
+
+	tb := &fakeTB{}
+	NoLeaks(tb, mgr)
+	leaked, err := mgr.CreateNew(context.Background())
+	assert.NoError(t, err)
+	tb.finish()
+	if assert.Len(t, tb.failures, 1) {
+		assert.Contains(t, tb.failures[0], leaked.GetId())
+		assert.NotContains(t, tb.failures[0], existing.GetId())
+	}
+
+	tb = &fakeTB{}
+	NoLeaks(tb, uow.NewManager(Factory()))
+	tb.finish()
+	if assert.Len(t, tb.failures, 1) {
+		assert.Contains(t, tb.failures[0], uow.ErrLeakDetectionDisabled.Error())
+	}
+}
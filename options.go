@@ -0,0 +1,91 @@
+package uow
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrUnitOfWorkNotCreated is returned by Manager.CreateNewOpts if the propagation runs without unit of work
+	ErrUnitOfWorkNotCreated = errors.New("propagation runs without unit of work")
+)
+
+// NewOption configures a single call of Manager.CreateNewOpts or Manager.WithNewOpts
+type NewOption func(*newOptions)
+
+type newOptions struct {
+	name        string
+	timeout     time.Duration
+	txOpt       []*sql.TxOptions
+	keyTxOpt    []keyTxOptions
+	labels      map[string]string
+	propagation Propagation
+	retry       *RetryPolicy
+	retrySet    bool
+	readOnly    bool
+}
+
+func newNewOptions(opts ...NewOption) *newOptions {
+	o := &newOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Name of unit of work
+func Name(name string) NewOption {
+	return func(o *newOptions) {
+		o.name = name
+	}
+}
+
+// Timeout of [fn] in Manager.WithNewOpts
+func Timeout(timeout time.Duration) NewOption {
+	return func(o *newOptions) {
+		o.timeout = timeout
+	}
+}
+
+// TxOptions used to begin transactions
+func TxOptions(txOpt ...*sql.TxOptions) NewOption {
+	return func(o *newOptions) {
+		o.txOpt = append(o.txOpt, txOpt...)
+	}
+}
+
+// Labels attach labels to unit of work. Multiple Labels are merged
+func Labels(labels map[string]string) NewOption {
+	return func(o *newOptions) {
+		if o.labels == nil {
+			o.labels = map[string]string{}
+		}
+		for k, v := range labels {
+			o.labels[k] = v
+		}
+	}
+}
+
+// Propagate change the Propagation. default is PropagationDefault
+func Propagate(p Propagation) NewOption {
+	return func(o *newOptions) {
+		o.propagation = p
+	}
+}
+
+// Retry override the RetryPolicy of Manager. nil disables retry
+func Retry(p *RetryPolicy) NewOption {
+	return func(o *newOptions) {
+		o.retry = p
+		o.retrySet = true
+	}
+}
+
+// ReadOnly begin transactions with ReadOnly TxOptions, and always roll back instead of committing.
+// It is still a successful unit of work for callbacks. Nested unit of work inherits read-only from parent
+func ReadOnly() NewOption {
+	return func(o *newOptions) {
+		o.readOnly = true
+	}
+}
@@ -0,0 +1,49 @@
+package otel
+
+import (
+	"context"
+	"github.com/go-saas/uow"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/go-saas/uow"
+
+// Tracer adapts OpenTelemetry trace.Tracer to uow.Tracer
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+var _ uow.Tracer = (*Tracer)(nil)
+
+// NewTracer create Tracer from [tp], global TracerProvider is used if nil
+func NewTracer(tp trace.TracerProvider) *Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return &Tracer{tracer: tp.Tracer(instrumentationName)}
+}
+
+func (t *Tracer) Start(ctx context.Context, name string, attrs ...uow.Attribute) (context.Context, uow.Span) {
+	kv := make([]attribute.KeyValue, len(attrs))
+	for i, attr := range attrs {
+		kv[i] = attribute.String(attr.Key, attr.Value)
+	}
+	ctx, span := t.tracer.Start(ctx, name, trace.WithAttributes(kv...), trace.WithSpanKind(trace.SpanKindInternal))
+	return ctx, &Span{span: span}
+}
+
+// Span adapts trace.Span to uow.Span
+type Span struct {
+	span trace.Span
+}
+
+func (s *Span) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
@@ -0,0 +1,115 @@
+package prometheus
+
+import (
+	"github.com/go-saas/uow"
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+// Metrics adapts prometheus collectors to uow.Metrics.
+// Keys are used as label values, enrich keys with high cardinality values like tenant carefully
+type Metrics struct {
+	completed    *prometheus.CounterVec
+	fnDuration   *prometheus.HistogramVec
+	txnCompleted *prometheus.CounterVec
+	begin        *prometheus.HistogramVec
+	beginFailed  *prometheus.CounterVec
+	commit       *prometheus.HistogramVec
+}
+
+var _ uow.Metrics = (*Metrics)(nil)
+
+type options struct {
+	namespace string
+	buckets   []float64
+}
+
+type Option func(*options)
+
+// WithNamespace prefix metric names. default is no namespace
+func WithNamespace(namespace string) Option {
+	return func(o *options) {
+		o.namespace = namespace
+	}
+}
+
+// WithBuckets change buckets of histograms. default is prometheus.DefBuckets
+func WithBuckets(buckets ...float64) Option {
+	return func(o *options) {
+		o.buckets = buckets
+	}
+}
+
+// NewMetrics create Metrics and register its collectors into [reg]
+func NewMetrics(reg prometheus.Registerer, opts ...Option) (*Metrics, error) {
+	o := &options{buckets: prometheus.DefBuckets}
+	for _, opt := range opts {
+		opt(o)
+	}
+	m := &Metrics{
+		completed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: o.namespace,
+			Subsystem: "uow",
+			Name:      "completed_total",
+			Help:      "Number of completed units of work by operation and outcome.",
+		}, []string{"operation", "outcome"}),
+		fnDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: o.namespace,
+			Subsystem: "uow",
+			Name:      "fn_duration_seconds",
+			Help:      "Time spent in the function of unit of work by operation and outcome.",
+			Buckets:   o.buckets,
+		}, []string{"operation", "outcome"}),
+		txnCompleted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: o.namespace,
+			Subsystem: "uow",
+			Name:      "txn_completed_total",
+			Help:      "Number of committed or rolled back transactions by operation, key and outcome.",
+		}, []string{"operation", "key", "outcome"}),
+		begin: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: o.namespace,
+			Subsystem: "uow",
+			Name:      "txn_begin_duration_seconds",
+			Help:      "Time spent beginning transactions by operation and key.",
+			Buckets:   o.buckets,
+		}, []string{"operation", "key"}),
+		beginFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: o.namespace,
+			Subsystem: "uow",
+			Name:      "txn_begin_failed_total",
+			Help:      "Number of transactions failed to begin by operation and key.",
+		}, []string{"operation", "key"}),
+		commit: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: o.namespace,
+			Subsystem: "uow",
+			Name:      "txn_commit_duration_seconds",
+			Help:      "Time spent committing transactions by operation and key.",
+			Buckets:   o.buckets,
+		}, []string{"operation", "key"}),
+	}
+	for _, c := range []prometheus.Collector{m.completed, m.fnDuration, m.txnCompleted, m.begin, m.beginFailed, m.commit} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (m *Metrics) UnitOfWorkCompleted(name string, outcome uow.Outcome, elapsed time.Duration) {
+	m.completed.WithLabelValues(name, string(outcome)).Inc()
+	m.fnDuration.WithLabelValues(name, string(outcome)).Observe(elapsed.Seconds())
+}
+
+func (m *Metrics) TxnBegan(name, key string, elapsed time.Duration, err error) {
+	m.begin.WithLabelValues(name, key).Observe(elapsed.Seconds())
+	if err != nil {
+		m.beginFailed.WithLabelValues(name, key).Inc()
+	}
+}
+
+func (m *Metrics) TxnCompleted(name, key string, outcome uow.Outcome, elapsed time.Duration) {
+	m.txnCompleted.WithLabelValues(name, key, string(outcome)).Inc()
+	if outcome == uow.OutcomeCommitted || outcome == uow.OutcomeCommitFailed {
+		m.commit.WithLabelValues(name, key).Observe(elapsed.Seconds())
+	}
+}
@@ -0,0 +1,83 @@
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"github.com/go-saas/uow"
+	"github.com/go-saas/uow/mock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m, err := NewMetrics(reg, WithNamespace("test"))
+	assert.NoError(t, err)
+	_, err = NewMetrics(reg, WithNamespace("test"))
+	assert.Error(t, err, "duplicate registration")
+
+	r := &mock.Recorder{}
+	a, b := mock.NewTransactionDb("a", r), mock.NewTransactionDb("b", r)
+	mgr := uow.NewManager(mock.Factory(a, b), uow.WithMetrics(m))
+	use := func(keys ...string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			u, _ := uow.FromCurrentUow(ctx)
+			for _, key := range keys {
+				if _, err := u.GetTxDb(ctx, key); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	assert.NoError(t, mgr.WithNewOpts(context.Background(), use("a", "b"), uow.Name("op")))
+	assert.Error(t, mgr.WithNewOpts(context.Background(), func(ctx context.Context) error {
+		_ = use("a")(ctx)
+		//joined unit of work is not counted
+		if err := mgr.WithNewOpts(ctx, use("a"), uow.Name("op"), uow.Propagate(uow.PropagationRequired)); err != nil {
+			return err
+		}
+		return errors.New("fn")
+	}, uow.Name("op")))
+	assert.Panics(t, func() {
+		_ = mgr.WithNewOpts(context.Background(), func(ctx context.Context) error {
+			_ = use("a")(ctx)
+			panic("fn")
+		}, uow.Name("op"))
+	})
+	//nested unit of work rolls back its savepoint even if parent commits
+	assert.NoError(t, mgr.WithNewOpts(context.Background(), func(ctx context.Context) error {
+		_ = mgr.WithNewOpts(ctx, func(ctx context.Context) error {
+			return errors.New("fn")
+		}, uow.Name("nested"), uow.Propagate(uow.PropagationNested))
+		return nil
+	}, uow.Name("root")))
+	b.CommitErr = errors.New("commit b")
+	assert.Error(t, mgr.WithNewOpts(context.Background(), use("a", "b"), uow.Name("op")))
+	b.BeginErr = errors.New("begin b")
+	assert.Error(t, mgr.WithNewOpts(context.Background(), use("b"), uow.Name("op")))
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.completed.WithLabelValues("op", "committed")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.completed.WithLabelValues("op", "rolled_back")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.completed.WithLabelValues("op", "panicked")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.completed.WithLabelValues("op", "commit_failed")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.completed.WithLabelValues("nested", "rolled_back")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.completed.WithLabelValues("root", "committed")))
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.txnCompleted.WithLabelValues("op", "a", "committed")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.txnCompleted.WithLabelValues("op", "b", "committed")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.txnCompleted.WithLabelValues("op", "b", "commit_failed")))
+	//a is rolled back by error, panic and commit failure of b
+	assert.Equal(t, float64(3), testutil.ToFloat64(m.txnCompleted.WithLabelValues("op", "a", "rolled_back")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.txnCompleted.WithLabelValues("op", "b", "rolled_back")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.beginFailed.WithLabelValues("op", "b")))
+
+	//histograms of uow, begin and commit
+	count, err := testutil.GatherAndCount(reg,
+		"test_uow_fn_duration_seconds", "test_uow_txn_begin_duration_seconds", "test_uow_txn_commit_duration_seconds")
+	assert.NoError(t, err)
+	assert.Equal(t, 6+2+2, count)
+}
@@ -0,0 +1,80 @@
+package uow
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrUnitOfWorkExists is returned by PropagationNever if there is a unit of work in context
+	ErrUnitOfWorkExists = errors.New("unit of work already exists")
+)
+
+// Propagation decides how a new unit of work relates to the current one in context
+type Propagation int
+
+const (
+	// PropagationDefault is PropagationRequired if Config.DisableNestedTransaction, otherwise PropagationNested
+	PropagationDefault Propagation = iota
+	// PropagationRequired join current unit of work, create a new one if absent
+	PropagationRequired
+	// PropagationRequiresNew always create an independent unit of work, ignoring the current one
+	PropagationRequiresNew
+	// PropagationSupports join current unit of work, run without unit of work if absent
+	PropagationSupports
+	// PropagationNotSupported run without unit of work, the current one is removed from context
+	PropagationNotSupported
+	// PropagationMandatory join current unit of work, return ErrUnitOfWorkNotFound if absent
+	PropagationMandatory
+	// PropagationNever run without unit of work, return ErrUnitOfWorkExists if present
+	PropagationNever
+	// PropagationNested begin nested transactions (e.g. savepoint) from current unit of work, create a new one if absent
+	PropagationNested
+)
+
+// resolve unit of work by Propagation. nil unit of work means [fn] should run without unit of work in returned context
+func (m *manager) resolve(ctx context.Context, o *newOptions) (*UnitOfWork, context.Context, error) {
+	p := o.propagation
+	if p == PropagationDefault {
+		p = PropagationNested
+		if m.cfg.DisableNestedTransaction {
+			p = PropagationRequired
+		}
+	}
+	current, ok := FromCurrentUow(ctx)
+	if !ok && m.isClosed() {
+		//only units of work nested in in-flight ones are allowed
+		switch p {
+		case PropagationRequired, PropagationRequiresNew, PropagationNested, PropagationMandatory:
+			return nil, ctx, ErrManagerClosed
+		}
+	}
+	switch p {
+	case PropagationRequired:
+		return m.createNew(ctx, current, true, o), ctx, nil
+	case PropagationRequiresNew:
+		return m.createNew(ctx, nil, false, o), ctx, nil
+	case PropagationSupports:
+		if !ok {
+			return nil, ctx, nil
+		}
+		return m.createNew(ctx, current, true, o), ctx, nil
+	case PropagationNotSupported:
+		if !ok {
+			return nil, ctx, nil
+		}
+		return nil, NewCurrentUow(ctx, nil), nil
+	case PropagationMandatory:
+		if !ok {
+			return nil, ctx, ErrUnitOfWorkNotFound
+		}
+		return m.createNew(ctx, current, true, o), ctx, nil
+	case PropagationNever:
+		if ok {
+			return nil, ctx, ErrUnitOfWorkExists
+		}
+		return nil, ctx, nil
+	default:
+		return m.createNew(ctx, current, false, o), ctx, nil
+	}
+}
@@ -0,0 +1,123 @@
+package uow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	// ErrNoFactory is matched by *NoFactoryError
+	ErrNoFactory = errors.New("no factory")
+)
+
+// NoFactoryError is returned by FactoryRegistry when no factory matches the key
+type NoFactoryError struct {
+	Key string
+}
+
+func (e *NoFactoryError) Error() string {
+	return fmt.Sprintf("no factory registered for key %s", e.Key)
+}
+
+func (e *NoFactoryError) Is(target error) bool {
+	return target == ErrNoFactory
+}
+
+type prefixFactory struct {
+	// prefix is leading key parts
+	prefix  []string
+	factory DbFactory
+}
+
+// FactoryRegistry resolve DbFactory by exact key, then the longest key prefix, then fallback.
+// Exact keys are matched after formatted by KeyFormatter, prefixes are matched by key parts. Pass Resolve to NewManager as DbFactory
+type FactoryRegistry struct {
+	mtx       sync.RWMutex
+	formatter KeyFormatter
+	exact     map[string]DbFactory
+	prefixes  []prefixFactory
+	fallback  DbFactory
+}
+
+// NewFactoryRegistry create a registry. [formatter] should be the same as Manager. nil means DefaultKeyFormatter
+func NewFactoryRegistry(formatter KeyFormatter) *FactoryRegistry {
+	if formatter == nil {
+		formatter = DefaultKeyFormatter
+	}
+	return &FactoryRegistry{
+		formatter: formatter,
+		exact:     map[string]DbFactory{},
+	}
+}
+
+// Register factory for exact keys
+func (r *FactoryRegistry) Register(factory DbFactory, keys ...string) *FactoryRegistry {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.exact[r.formatter(keys...)] = factory
+	return r
+}
+
+// RegisterKey register factory for ResourceKey
+func (r *FactoryRegistry) RegisterKey(factory DbFactory, key ResourceKey) *FactoryRegistry {
+	return r.Register(factory, key.Keys()...)
+}
+
+// RegisterPrefix register factory for keys whose leading parts equal to [prefix] part by part,
+// e.g. prefix "orders" matches keys ("orders", "tenant1") but not ("orders_archive"). The longest prefix wins
+func (r *FactoryRegistry) RegisterPrefix(factory DbFactory, prefix ...string) *FactoryRegistry {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.prefixes = append(r.prefixes, prefixFactory{prefix: append([]string(nil), prefix...), factory: factory})
+	return r
+}
+
+// Fallback set factory for keys which match nothing
+func (r *FactoryRegistry) Fallback(factory DbFactory) *FactoryRegistry {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.fallback = factory
+	return r
+}
+
+// Resolve is a DbFactory which delegates to the matched factory, or returns *NoFactoryError
+func (r *FactoryRegistry) Resolve(ctx context.Context, keys ...string) (TransactionalDb, error) {
+	key := r.formatter(keys...)
+	factory := r.match(key, keys)
+	if factory == nil {
+		return nil, &NoFactoryError{Key: key}
+	}
+	return factory(ctx, keys...)
+}
+
+func (r *FactoryRegistry) match(key string, keys []string) DbFactory {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	if f, ok := r.exact[key]; ok {
+		return f
+	}
+	var matched *prefixFactory
+	for i, p := range r.prefixes {
+		if hasPrefix(keys, p.prefix) && (matched == nil || len(p.prefix) > len(matched.prefix)) {
+			matched = &r.prefixes[i]
+		}
+	}
+	if matched != nil {
+		return matched.factory
+	}
+	return r.fallback
+}
+
+func hasPrefix(keys, prefix []string) bool {
+	if len(keys) < len(prefix) {
+		return false
+	}
+	for i, p := range prefix {
+		if keys[i] != p {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,41 @@
+package uow
+
+import (
+	"context"
+	"sync"
+)
+
+type releasesKey struct{}
+
+// releases run when the transaction of a key ends
+type releases struct {
+	mtx sync.Mutex
+	fns []func()
+}
+
+func (r *releases) add(fn func()) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.fns = append(r.fns, fn)
+}
+
+func (r *releases) run() {
+	r.mtx.Lock()
+	fns := r.fns
+	r.fns = nil
+	r.mtx.Unlock()
+	for _, fn := range fns {
+		fn()
+	}
+}
+
+// OnRelease register [fn] to run once the transaction being begun with [ctx] is committed or rolled back, or fails to begin.
+// DbFactory can use it to track resources in use, e.g. CachingFactory. Returns false if [ctx] is not beginning a transaction
+func OnRelease(ctx context.Context, fn func()) bool {
+	r, ok := ctx.Value(releasesKey{}).(*releases)
+	if !ok {
+		return false
+	}
+	r.add(fn)
+	return true
+}
@@ -0,0 +1,100 @@
+package uow
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+var (
+	// ErrRetryable can be wrapped to mark an error as retryable for DefaultIsRetryable
+	ErrRetryable = errors.New("retryable")
+)
+
+// RetryPolicy re-run [fn] in a fresh UnitOfWork when it fails with retryable error.
+// Retry never happens when the call is nested inside an existing unit of work,
+// or when commit fails after some transactions are already committed, see CommitError
+type RetryPolicy struct {
+	// MaxAttempts including the first one. less than 2 means no retry
+	MaxAttempts int
+	// InitialBackoff wait before the first retry, doubled for each following retry
+	InitialBackoff time.Duration
+	// MaxBackoff caps the backoff. zero means no cap
+	MaxBackoff time.Duration
+	// Jitter in [0,1] randomly reduces backoff by up to this fraction
+	Jitter float64
+	// IsRetryable classify errors returned by [fn] or commit. default DefaultIsRetryable
+	IsRetryable func(err error) bool
+}
+
+// DefaultRetryPolicy retry 3 times with backoff from 10ms to 1s
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Jitter:         0.2,
+	}
+}
+
+// DefaultIsRetryable recognize ErrRetryable, and driver errors with SQLSTATE 40001(serialization_failure) or 40P01(deadlock_detected)
+// exposed by SQLState() method like pgx and lib/pq
+func DefaultIsRetryable(err error) bool {
+	if errors.Is(err, ErrRetryable) {
+		return true
+	}
+	var stateErr interface{ SQLState() string }
+	if errors.As(err, &stateErr) {
+		switch stateErr.SQLState() {
+		case "40001", "40P01":
+			return true
+		}
+	}
+	return false
+}
+
+func (p *RetryPolicy) shouldRetry(attempt int, err error) bool {
+	if p == nil || attempt >= p.MaxAttempts {
+		return false
+	}
+	var commitErr *CommitError
+	if errors.As(err, &commitErr) && len(commitErr.Committed) > 0 {
+		//committed transactions are durable, re-running fn would apply them again
+		return false
+	}
+	isRetryable := p.IsRetryable
+	if isRetryable == nil {
+		isRetryable = DefaultIsRetryable
+	}
+	return isRetryable(err)
+}
+
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		d -= time.Duration(float64(d) * p.Jitter * rand.Float64())
+	}
+	return d
+}
+
+// wait backoff of attempt, returns ctx error if ctx is done before that
+func (p *RetryPolicy) wait(ctx context.Context, attempt int) error {
+	t := time.NewTimer(p.backoff(attempt))
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,92 @@
+package uow
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Role of database in read-replica routing
+type Role int
+
+const (
+	// RolePrimary accepts reads and writes
+	RolePrimary Role = iota
+	// RoleReplica only serves reads which do not need to see writes in the unit of work
+	RoleReplica
+)
+
+// replicaKeySuffix separates replica transactions from primary ones in unit of work
+const replicaKeySuffix = "#replica"
+
+// WithReplicaFactory resolve TransactionalDb for RoleReplica. Without it, RoleReplica is routed to primary
+func WithReplicaFactory(factory DbFactory) Option {
+	return func(config *Config) {
+		config.replicaFactory = factory
+	}
+}
+
+// GetTxDbRole resolve transaction of keys by Role. Replica transactions begin with ReadOnly TxOptions.
+//
+// Routing fails closed: once MarkWritten is called in the unit of work or its ancestors, RoleReplica is routed to primary.
+// Reading from primary does not disable routing. The unit of work can not tell reads from writes, so writers should
+// call MarkWritten, or use write hooks of adapters like gorm.WriteTracker
+func (u *UnitOfWork) GetTxDbRole(ctx context.Context, role Role, keys ...string) (Txn, error) {
+	if role == RolePrimary || u.replicaFactory == nil || u.isWritten() {
+		return u.GetTxDb(ctx, keys...)
+	}
+	keys, err := u.resolveKeys(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	return u.getReplicaTxDb(ctx, keys)
+}
+
+// MarkWritten mark the unit of work as written, so that following RoleReplica requests use primary
+func (u *UnitOfWork) MarkWritten() {
+	for p := u; p != nil; p = p.parent {
+		p.mtx.Lock()
+		p.written = true
+		p.mtx.Unlock()
+	}
+}
+
+func (u *UnitOfWork) isWritten() bool {
+	for p := u; p != nil; p = p.parent {
+		p.mtx.Lock()
+		written := p.written
+		p.mtx.Unlock()
+		if written {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *UnitOfWork) getReplicaTxDb(ctx context.Context, keys []string) (Txn, error) {
+	key := u.formatter(keys...)
+	return u.loadOrBegin(ctx, key+replicaKeySuffix, func(parent *UnitOfWork) (Txn, error) {
+		return parent.getReplicaTxDb(ctx, keys)
+	}, func(ctx context.Context) (Txn, error) {
+		db, err := u.replicaFactory(ctx, keys...)
+		if err != nil {
+			return nil, err
+		}
+		return db.Begin(readOnly(u.txOptions(key, nil))...)
+	})
+}
+
+// readOnly copy TxOptions with ReadOnly
+func readOnly(opt []*sql.TxOptions) []*sql.TxOptions {
+	if len(opt) == 0 {
+		return []*sql.TxOptions{{ReadOnly: true}}
+	}
+	ret := make([]*sql.TxOptions, len(opt))
+	for i, o := range opt {
+		c := sql.TxOptions{ReadOnly: true}
+		if o != nil {
+			c.Isolation = o.Isolation
+		}
+		ret[i] = &c
+	}
+	return ret
+}
@@ -0,0 +1,159 @@
+package uow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrManagerClosed is returned when creating unit of work after Manager.Shutdown or Manager.Close.
+	// Units of work nested in in-flight ones are still allowed
+	ErrManagerClosed = errors.New("unit of work manager is closed")
+)
+
+// ShutdownError is returned by Manager.Shutdown if in-flight units of work are not finished in time, or resources fail to close
+type ShutdownError struct {
+	// Err is ctx.Err() if in-flight units of work are not finished in time
+	Err error
+	// RolledBack ids of in-flight units of work rolled back
+	RolledBack []string
+	// Errs of units of work failing to roll back keyed by id, and of resources failing to close keyed by type
+	Errs []*KeyError
+}
+
+func (e *ShutdownError) Error() string {
+	msg := "shutting down unit of work manager fail"
+	if e.Err != nil {
+		msg = fmt.Sprintf("%s: %s, rolled back: [%s]", msg, e.Err.Error(), strings.Join(e.RolledBack, ","))
+	}
+	if len(e.Errs) > 0 {
+		msg = msg + "\n" + keyErrors(e.Errs).Error()
+	}
+	return msg
+}
+
+// Is reports whether any key error matches target. Err is checked through Unwrap
+func (e *ShutdownError) Is(target error) bool {
+	return keyErrors(e.Errs).Is(target)
+}
+
+// As finds the first key error that matches target. Err is checked through Unwrap
+func (e *ShutdownError) As(target interface{}) bool {
+	return keyErrors(e.Errs).As(target)
+}
+
+func (e *ShutdownError) Unwrap() error {
+	return e.Err
+}
+
+// WithShutdownGracePeriod let Manager.Shutdown wait up to [d] after its ctx is done for WithTx callbacks to release
+// transactions of remaining units of work before rolling them back. Transactions still in use afterwards are rolled back
+// underneath the callbacks. default is zero, no wait
+func WithShutdownGracePeriod(d time.Duration) Option {
+	return func(config *Config) {
+		config.shutdownGrace = d
+	}
+}
+
+// Shutdown stop creating units of work with ErrManagerClosed, wait for in-flight ones until ctx is done,
+// then roll back the remaining ones and close resources registered by WithCloser
+func (m *manager) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&m.closed, 1)
+	serr := &ShutdownError{}
+	if err := m.live.wait(ctx); err != nil {
+		serr.Err = err
+		lockCtx, cancel := context.WithTimeout(detach(ctx), m.cfg.shutdownGrace)
+		defer cancel()
+		//children first
+		units := m.live.list()
+		for i := len(units) - 1; i >= 0; i-- {
+			u := units[i]
+			aborted, rerr := u.abort(detach(ctx), lockCtx, errAbortedByShutdown)
+			if !aborted {
+				//finished meanwhile
+				continue
+			}
+			//ErrUnitOfWorkCompleted means the unit of work rolled back itself after being aborted
+			if rerr != nil && !errors.Is(rerr, ErrUnitOfWorkCompleted) {
+				serr.Errs = append(serr.Errs, &KeyError{Key: u.id, Err: rerr})
+			}
+			serr.RolledBack = append(serr.RolledBack, u.id)
+		}
+	}
+	if err := m.Close(); err != nil {
+		serr.Errs = append(serr.Errs, err.(keyErrors)...)
+	}
+	if serr.Err != nil || len(serr.Errs) > 0 {
+		return serr
+	}
+	return nil
+}
+
+// errAbortedByShutdown is returned by WithCurrentUnitOfWork if the unit of work is rolled back by Shutdown
+var errAbortedByShutdown = fmt.Errorf("unit of work rolled back by shutdown: %w", ErrManagerClosed)
+
+// abort roll back in-flight unit of work. Locks of its transactions are acquired until [lockCtx] is done,
+// so that WithTx callers are not interrupted. Once aborted, the unit of work can not commit anymore
+// and WithCurrentUnitOfWork returns [cause]. Returns false if the unit of work is already finished
+func (u *UnitOfWork) abort(ctx, lockCtx context.Context, cause error) (bool, error) {
+	u.mtx.Lock()
+	if u.state != StateActive && u.state != StateFailed {
+		u.mtx.Unlock()
+		return false, nil
+	}
+	u.aborted = cause
+	u.mtx.Unlock()
+	unlock := u.lockTxs(lockCtx)
+	defer unlock()
+	return true, u.RollbackContext(ctx)
+}
+
+// abortedErr return the cause if aborted
+func (u *UnitOfWork) abortedErr() error {
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+	return u.aborted
+}
+
+// lockTxs acquire locks of all transactions at once, so that it never holds some of them while waiting for others.
+// Nothing is locked if [ctx] is done before that
+func (u *UnitOfWork) lockTxs(ctx context.Context) (unlock func()) {
+	keys := u.openKeys()
+	locks := make([]*sync.Mutex, len(keys))
+	for i, key := range keys {
+		locks[i] = u.txLock(key)
+	}
+	for {
+		acquired := 0
+		for _, l := range locks {
+			if !l.TryLock() {
+				break
+			}
+			acquired++
+		}
+		if acquired == len(locks) {
+			return func() {
+				for _, l := range locks {
+					l.Unlock()
+				}
+			}
+		}
+		for _, l := range locks[:acquired] {
+			l.Unlock()
+		}
+		select {
+		case <-ctx.Done():
+			return func() {}
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func (m *manager) isClosed() bool {
+	return atomic.LoadInt32(&m.closed) == 1
+}
@@ -0,0 +1,108 @@
+package uow
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// SlowReport describes a unit of work, or the transaction of a key, open longer than the threshold
+type SlowReport struct {
+	// Id of unit of work from GetId
+	Id   string
+	Name string
+	// Key formatted by KeyFormatter if the transaction of Key is slow, empty if the whole unit of work is slow
+	Key string
+	// Keys of transactions still open
+	Keys []string
+	// Stack where the unit of work is created
+	Stack   []byte
+	Elapsed time.Duration
+}
+
+func (r *SlowReport) String() string {
+	target := "unit of work"
+	if len(r.Key) > 0 {
+		target = "transaction " + r.Key + " of unit of work"
+	}
+	return fmt.Sprintf("%s %s(%s) open for %s, open keys: [%s]\n%s", target, r.Id, r.Name, r.Elapsed, strings.Join(r.Keys, ","), r.Stack)
+}
+
+// SlowFunc is called once for each unit of work and each transaction open longer than the threshold.
+// It runs in its own goroutine while the unit of work is still open
+type SlowFunc func(r *SlowReport)
+
+// DefaultSlowFunc logs the report
+var DefaultSlowFunc SlowFunc = func(r *SlowReport) {
+	log.Printf("[uow] slow %s", r)
+}
+
+// WithSlowThreshold report unit of work and transactions open longer than [threshold] to [fn], DefaultSlowFunc if nil.
+// Creation stack is captured for each unit of work. default is disabled
+func WithSlowThreshold(threshold time.Duration, fn SlowFunc) Option {
+	return func(config *Config) {
+		if fn == nil {
+			fn = DefaultSlowFunc
+		}
+		config.slowThreshold = threshold
+		config.slowFn = fn
+	}
+}
+
+// watchSlow start reporting the unit of work if it is still open after threshold
+func (u *UnitOfWork) watchSlow() {
+	if u.slowThreshold <= 0 {
+		return
+	}
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+	u.slowTimer = time.AfterFunc(u.slowThreshold, func() {
+		u.reportSlow("", u.createdAt)
+	})
+}
+
+// watchSlowKey start reporting the transaction of [key] if it is still open after threshold. lock should be held
+func (u *UnitOfWork) watchSlowKey(key string) {
+	if u.slowThreshold <= 0 {
+		return
+	}
+	if u.keyTimers == nil {
+		u.keyTimers = map[string]*time.Timer{}
+	}
+	began := time.Now()
+	u.keyTimers[key] = time.AfterFunc(u.slowThreshold, func() {
+		u.reportSlow(key, began)
+	})
+}
+
+// unwatchSlowKey stop reporting the transaction of [key]. lock should be held
+func (u *UnitOfWork) unwatchSlowKey(key string) {
+	if t, ok := u.keyTimers[key]; ok {
+		t.Stop()
+		delete(u.keyTimers, key)
+	}
+}
+
+// unwatchSlow stop reporting the unit of work and all its transactions
+func (u *UnitOfWork) unwatchSlow() {
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+	if u.slowTimer != nil {
+		u.slowTimer.Stop()
+	}
+	for key := range u.keyTimers {
+		u.unwatchSlowKey(key)
+	}
+}
+
+func (u *UnitOfWork) reportSlow(key string, since time.Time) {
+	u.slowFn(&SlowReport{
+		Id:      u.id,
+		Name:    u.name,
+		Key:     key,
+		Keys:    u.openKeys(),
+		Stack:   u.stack,
+		Elapsed: time.Since(since),
+	})
+}
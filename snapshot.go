@@ -0,0 +1,71 @@
+package uow
+
+import "time"
+
+// UnitSnapshot is a point-in-time view of a live unit of work
+type UnitSnapshot struct {
+	Id   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	// ParentId is empty for root
+	ParentId string            `json:"parent_id,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	State    State             `json:"state"`
+	// Join the transactions of parent instead of beginning its own
+	Join         bool      `json:"join"`
+	ReadOnly     bool      `json:"read_only"`
+	RollbackOnly bool      `json:"rollback_only"`
+	CreatedAt    time.Time `json:"created_at"`
+	// Keys of open transactions in order of beginning
+	Keys     []*KeySnapshot  `json:"keys"`
+	Children []*UnitSnapshot `json:"children,omitempty"`
+}
+
+// KeySnapshot is an open transaction of UnitSnapshot
+type KeySnapshot struct {
+	// Key formatted by KeyFormatter
+	Key     string    `json:"key"`
+	BeganAt time.Time `json:"began_at"`
+}
+
+// Snapshot return live units of work created by the manager as trees, roots and children are in order of creation.
+// A unit of work whose parent is completed becomes a root
+func (m *manager) Snapshot() []*UnitSnapshot {
+	units := m.live.list()
+	snapshots := make(map[*UnitOfWork]*UnitSnapshot, len(units))
+	for _, u := range units {
+		snapshots[u] = u.snapshot()
+	}
+	var roots []*UnitSnapshot
+	for _, u := range units {
+		s := snapshots[u]
+		if p, ok := snapshots[u.parent]; ok && u.parent != nil {
+			p.Children = append(p.Children, s)
+		} else {
+			roots = append(roots, s)
+		}
+	}
+	return roots
+}
+
+func (u *UnitOfWork) snapshot() *UnitSnapshot {
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+	s := &UnitSnapshot{
+		Id:           u.id,
+		Name:         u.name,
+		Labels:       u.Labels(),
+		State:        u.state,
+		Join:         u.join,
+		ReadOnly:     u.readOnly,
+		RollbackOnly: u.rollbackOnly,
+		CreatedAt:    u.createdAt,
+		Keys:         make([]*KeySnapshot, 0, u.db.Len()),
+	}
+	if u.parent != nil {
+		s.ParentId = u.parent.id
+	}
+	for el := u.db.Front(); el != nil; el = el.Next() {
+		s.Keys = append(s.Keys, &KeySnapshot{Key: el.Key, BeganAt: u.began[el.Key]})
+	}
+	return s
+}
@@ -0,0 +1,82 @@
+package uow
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrUnitOfWorkCompleted is returned when using a unit of work which is no longer active
+	ErrUnitOfWorkCompleted = errors.New("unit of work already completed")
+)
+
+// State of UnitOfWork
+type State int
+
+const (
+	// StateActive accepts new transactions, and can be committed or rolled back
+	StateActive State = iota
+	// StateCommitting is committing transactions
+	StateCommitting
+	// StateCommitted all transactions are committed
+	StateCommitted
+	// StateRolledBack all transactions are rolled back
+	StateRolledBack
+	// StateFailed commit failed, some transactions may be committed. See CommitError
+	StateFailed
+)
+
+func (s State) String() string {
+	switch s {
+	case StateActive:
+		return "Active"
+	case StateCommitting:
+		return "Committing"
+	case StateCommitted:
+		return "Committed"
+	case StateRolledBack:
+		return "RolledBack"
+	case StateFailed:
+		return "Failed"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// MarshalText encode State as String
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// State return current state of unit of work
+func (u *UnitOfWork) State() State {
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+	return u.state
+}
+
+// finished reports whether the unit of work is committed or rolled back, so that Rollback is not allowed
+func (u *UnitOfWork) finished() bool {
+	s := u.State()
+	return s == StateCommitted || s == StateRolledBack
+}
+
+func (u *UnitOfWork) setState(s State) {
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+	u.state = s
+}
+
+// transit to [to] only if current state is [from]. Aborted unit of work is left to roll back
+func (u *UnitOfWork) transit(to State, from State) error {
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+	if u.aborted != nil {
+		return u.aborted
+	}
+	if u.state != from {
+		return fmt.Errorf("%w: can not transit from %s to %s", ErrUnitOfWorkCompleted, u.state, to)
+	}
+	u.state = to
+	return nil
+}
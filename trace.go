@@ -0,0 +1,71 @@
+package uow
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// SpanWithNew covers Manager.WithNew from resolving unit of work to commit or rollback
+	SpanWithNew = "uow.WithNew"
+	// SpanBegin covers resolving DbFactory and beginning the transaction of a key
+	SpanBegin = "uow.Begin"
+	// SpanPrepare covers preparing the transaction of a key in two-phase commit
+	SpanPrepare = "uow.Prepare"
+	// SpanCommit covers committing the transaction of a key
+	SpanCommit = "uow.Commit"
+	// SpanRollback covers rolling back the transaction of a key
+	SpanRollback = "uow.Rollback"
+
+	// AttrId is the id of unit of work from GetId
+	AttrId = "uow.id"
+	// AttrName is the name of unit of work from NewOption Name
+	AttrName = "uow.name"
+	// AttrKey is the key formatted by KeyFormatter
+	AttrKey = "uow.key"
+)
+
+// Attribute is a key-value pair attached to Span
+type Attribute struct {
+	Key   string
+	Value string
+}
+
+// Tracer starts spans of unit of work. Returned context carries the span, spans started from it are its children
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is started by Tracer
+type Span interface {
+	// End the span, err is recorded if not nil
+	End(err error)
+}
+
+// WithTracer emit spans of WithNew, Begin, Prepare, Commit and Rollback. default is no tracing
+func WithTracer(t Tracer) Option {
+	return func(config *Config) {
+		config.tracer = t
+	}
+}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) End(err error) {}
+
+// trace run [fn] in a span of the transaction of [key], the span is the child of unit of work span.
+// Metrics is also observed
+func (u *UnitOfWork) trace(name, key string, fn func() error) error {
+	_, span := u.tracer.Start(u.traceCtx, name, Attribute{Key: AttrKey, Value: key}, Attribute{Key: AttrId, Value: u.id})
+	start := time.Now()
+	err := fn()
+	u.observe(name, key, time.Since(start), err)
+	span.End(err)
+	return err
+}
@@ -0,0 +1,65 @@
+package uow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var (
+	// ErrTxnTypeMismatch is matched by *TxnTypeMismatchError
+	ErrTxnTypeMismatch = errors.New("transaction type mismatch")
+)
+
+// TxnTypeMismatchError is returned by GetTx when the transaction is not the expected type
+type TxnTypeMismatchError struct {
+	Key      string
+	Expected string
+	Actual   string
+}
+
+func (e *TxnTypeMismatchError) Error() string {
+	return fmt.Sprintf("transaction type mismatch of key %s: expected %s, actual %s", e.Key, e.Expected, e.Actual)
+}
+
+func (e *TxnTypeMismatchError) Is(target error) bool {
+	return target == ErrTxnTypeMismatch
+}
+
+// GetTx resolve transaction of keys from current unit of work as type T
+func GetTx[T any](ctx context.Context, keys ...string) (T, error) {
+	u, ok := FromCurrentUow(ctx)
+	if !ok {
+		var zero T
+		return zero, ErrUnitOfWorkNotFound
+	}
+	return GetTxFrom[T](ctx, u, keys...)
+}
+
+// GetTxFrom resolve transaction of keys from unit of work [u] as type T
+func GetTxFrom[T any](ctx context.Context, u *UnitOfWork, keys ...string) (T, error) {
+	var zero T
+	tx, err := u.GetTxDb(ctx, keys...)
+	if err != nil {
+		return zero, err
+	}
+	t, ok := tx.(T)
+	if !ok {
+		return zero, &TxnTypeMismatchError{
+			Key:      u.formatter(keys...),
+			Expected: reflect.TypeOf((*T)(nil)).Elem().String(),
+			Actual:   fmt.Sprintf("%T", tx),
+		}
+	}
+	return t, nil
+}
+
+// MustGetTx is like GetTx but panics if any error
+func MustGetTx[T any](ctx context.Context, keys ...string) T {
+	t, err := GetTx[T](ctx, keys...)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
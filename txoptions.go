@@ -0,0 +1,61 @@
+package uow
+
+import (
+	"database/sql"
+	"path"
+)
+
+// keyTxOptions TxOptions for keys matching Pattern
+type keyTxOptions struct {
+	pattern string
+	opt     []*sql.TxOptions
+}
+
+func (k keyTxOptions) match(key string) bool {
+	if k.pattern == key {
+		return true
+	}
+	ok, _ := path.Match(k.pattern, key)
+	return ok
+}
+
+// WithKeyTxOptions use [opt] to begin transactions whose formatted key matches [pattern].
+// [pattern] follows path.Match, so "orders/*" matches "orders/tenant1" with DefaultKeyFormatter.
+// The first matched pattern wins, and per-call KeyTxOptions takes precedence
+func WithKeyTxOptions(pattern string, opt ...*sql.TxOptions) Option {
+	return func(config *Config) {
+		config.keyTxOpt = append(config.keyTxOpt, keyTxOptions{pattern: pattern, opt: opt})
+	}
+}
+
+// KeyTxOptions use [opt] to begin transactions whose formatted key matches [pattern] in this call.
+// See WithKeyTxOptions for pattern syntax
+func KeyTxOptions(pattern string, opt ...*sql.TxOptions) NewOption {
+	return func(o *newOptions) {
+		o.keyTxOpt = append(o.keyTxOpt, keyTxOptions{pattern: pattern, opt: opt})
+	}
+}
+
+// txOptions resolve TxOptions of formatted key in order of: per-call patterns, [keyOpt] from ResourceKey,
+// patterns from Manager, and TxOptions of unit of work
+func (u *UnitOfWork) txOptions(key string, keyOpt []*sql.TxOptions) []*sql.TxOptions {
+	if opt, ok := matchKeyTxOptions(u.callKeyTxOpt, key); ok {
+		return opt
+	}
+	if keyOpt != nil {
+		return keyOpt
+	}
+	if opt, ok := matchKeyTxOptions(u.keyTxOpt, key); ok {
+		return opt
+	}
+	return u.opt
+}
+
+func matchKeyTxOptions(opts []keyTxOptions, key string) ([]*sql.TxOptions, bool) {
+	for _, k := range opts {
+		if k.match(key) {
+			return k.opt, true
+		}
+	}
+	return nil, false
+}
@@ -15,5 +15,23 @@ type Txn interface {
 	Rollback() error
 }
 
+// TxnContext is an optional interface for Txn which accepts context when committing or rolling back.
+// Methods are suffixed with Context, so that adapters can implement both Txn and TxnContext
+type TxnContext interface {
+	CommitContext(ctx context.Context) error
+	RollbackContext(ctx context.Context) error
+}
+
 // DbFactory resolve transactional db by database keys
 type DbFactory func(ctx context.Context, keys ...string) (TransactionalDb, error)
+
+// Preparer is an optional interface for Txn which supports two-phase commit.
+// It is only used when the Manager is configured with CommitModeTwoPhase
+type Preparer interface {
+	// Prepare the transaction so that the following CommitPrepared should not fail
+	Prepare() error
+	// CommitPrepared commit a prepared transaction
+	CommitPrepared() error
+	// RollbackPrepared rollback a prepared transaction
+	RollbackPrepared() error
+}
@@ -6,98 +6,509 @@ import (
 	"errors"
 	"fmt"
 	orderedmap "github.com/elliotchance/orderedmap/v2"
-	"strings"
 	"sync"
+	"time"
 )
 
 var (
 	ErrUnitOfWorkNotFound = errors.New("unit of work not found, please wrap with manager.WithNew")
+	// ErrRollbackOnly is returned by commit if the unit of work is marked by SetRollbackOnly
+	ErrRollbackOnly = errors.New("unit of work is marked as rollback-only")
+	// ErrMultipleLastResource two-phase commit can only handle one transaction which does not implement Preparer
+	ErrMultipleLastResource = errors.New("two-phase commit allows at most one transaction without Preparer")
 )
 
 type UnitOfWork struct {
-	id            string
-	parent        *UnitOfWork
-	factory       DbFactory
-	disableNested bool
+	id      string
+	name    string
+	labels  map[string]string
+	parent  *UnitOfWork
+	factory DbFactory
+	// join the transactions of parent instead of beginning nested ones
+	join bool
 	// db can be any kind of client
-	db        *orderedmap.OrderedMap[string, Txn]
-	mtx       sync.Mutex
-	opt       []*sql.TxOptions
-	formatter KeyFormatter
+	db *orderedmap.OrderedMap[string, Txn]
+	// pending transactions being began
+	pending map[string]*pendingTxn
+	mtx     sync.Mutex
+	opt     []*sql.TxOptions
+	// callKeyTxOpt from NewOption takes precedence over keyTxOpt from Manager
+	callKeyTxOpt []keyTxOptions
+	keyTxOpt     []keyTxOptions
+	knownKeys    map[string]struct{}
+	keyOpt       map[string][]*sql.TxOptions
+	enrichers    []KeyEnricher
+	formatter    KeyFormatter
+	commitMode   CommitMode
+	callbacks    callbacks
+	state        State
+	// rollbackOnly is set by SetRollbackOnly
+	rollbackOnly bool
+
+	// replicaFactory resolves RoleReplica, written disables it
+	replicaFactory DbFactory
+	written        bool
+	// children started by Go or Group, childErr is the first error of them
+	children sync.WaitGroup
+	childErr error
+	// txLocks serialize access to transactions by formatted key, only used by root
+	txLocks map[string]*sync.Mutex
+	// readOnly never commits and begins transactions with ReadOnly TxOptions
+	readOnly bool
+	// tracer starts transaction spans in traceCtx, which carries the span of unit of work
+	tracer   Tracer
+	traceCtx context.Context
+	metrics  Metrics
+	// createdAt and stack where the unit of work is created, stack is only captured if needed
+	createdAt time.Time
+	stack     []byte
+	// slowTimer and keyTimers report to slowFn if the unit of work or transactions are open longer than slowThreshold
+	slowThreshold time.Duration
+	slowFn        SlowFunc
+	slowTimer     *time.Timer
+	keyTimers     map[string]*time.Timer
+	// live tracks the unit of work until finished
+	live *liveUnits
+	// began time of each transaction
+	began map[string]time.Time
+	// releases registered by OnRelease of each transaction
+	releases map[string]*releases
+	// aborted is the cause if rolled back by Shutdown
+	aborted error
 }
 
-func newUnitOfWork(id string, disableNested bool, parent *UnitOfWork, factory DbFactory, formatter KeyFormatter, opt ...*sql.TxOptions) *UnitOfWork {
+func newUnitOfWork(id string, parent *UnitOfWork, join bool, factory DbFactory, cfg *Config, o *newOptions) *UnitOfWork {
 	return &UnitOfWork{
-		id:            id,
-		parent:        parent,
-		factory:       factory,
-		disableNested: disableNested,
-		formatter:     formatter,
-		db:            orderedmap.NewOrderedMap[string, Txn](),
-		opt:           opt,
+		id:           id,
+		name:         o.name,
+		labels:       o.labels,
+		parent:       parent,
+		join:         join,
+		factory:      factory,
+		formatter:    cfg.formatter,
+		commitMode:   cfg.CommitMode,
+		db:           orderedmap.NewOrderedMap[string, Txn](),
+		pending:      map[string]*pendingTxn{},
+		opt:          o.txOpt,
+		callKeyTxOpt: o.keyTxOpt,
+		keyTxOpt:     cfg.keyTxOpt,
+		knownKeys:    cfg.knownKeys,
+		keyOpt:       cfg.keyOpt,
+		enrichers:    cfg.enrichers,
+
+		replicaFactory: cfg.replicaFactory,
+		readOnly:       o.readOnly || (parent != nil && parent.readOnly),
+		tracer:         cfg.tracer,
+		traceCtx:       context.Background(),
+		metrics:        cfg.metrics,
+		createdAt:      time.Now(),
+		slowThreshold:  cfg.slowThreshold,
+		slowFn:         cfg.slowFn,
+		began:          map[string]time.Time{},
+		releases:       map[string]*releases{},
 	}
 }
 
+// Commit all transactions in reverse order of beginning. Committed transactions are removed from the unit of work,
+// so a following Rollback only affects the remaining ones. Returns *CommitError if any transaction fails
 func (u *UnitOfWork) Commit() error {
-	for el := u.db.Back(); el != nil; el = el.Prev() {
-		err := el.Value.Commit()
-		if err != nil {
-			return err
+	return u.CommitContext(context.Background())
+}
+
+// CommitContext is Commit with context passed to TxnContext
+func (u *UnitOfWork) CommitContext(ctx context.Context) error {
+	if u.IsRollbackOnly() {
+		//left to Rollback
+		return ErrRollbackOnly
+	}
+	if err := u.transit(StateCommitting, StateActive); err != nil {
+		return err
+	}
+	if u.readOnly {
+		//never commit read-only unit of work
+		err := u.rollback(ctx)
+		u.setState(StateRolledBack)
+		return err
+	}
+	err := u.commit(ctx)
+	if err != nil {
+		//remaining transactions are left to Rollback
+		u.setState(StateFailed)
+	} else {
+		u.setState(StateCommitted)
+		u.finish()
+	}
+	return err
+}
+
+func (u *UnitOfWork) commit(ctx context.Context) error {
+	if u.commitMode == CommitModeTwoPhase {
+		return u.commitTwoPhase(ctx)
+	}
+	keys := u.reversedKeys()
+	var committed []string
+	for i, key := range keys {
+		tx := u.txOf(key)
+		if err := u.commitTxn(ctx, key, tx); err != nil {
+			return &CommitError{
+				Committed: committed,
+				Failed:    []string{key},
+				Skipped:   keys[i+1:],
+				Errs:      []*KeyError{{Key: key, Err: err}},
+			}
 		}
+		u.removeTx(key)
+		committed = append(committed, key)
 	}
 	return nil
 }
 
-func (u *UnitOfWork) Rollback() error {
-	var errs []string
+// commitTwoPhase prepare all Preparer first, then commit the last resource, then commit all prepared
+func (u *UnitOfWork) commitTwoPhase(ctx context.Context) error {
+	var preparers []string
+	var last string
+	for _, key := range u.reversedKeys() {
+		tx := u.txOf(key)
+		if _, ok := tx.(Preparer); ok {
+			preparers = append(preparers, key)
+			continue
+		}
+		if len(last) > 0 {
+			return ErrMultipleLastResource
+		}
+		last = key
+	}
+
+	//phase one
+	for i, key := range preparers {
+		tx := u.txOf(key)
+		if err := u.trace(SpanPrepare, key, tx.(Preparer).Prepare); err != nil {
+			//unprepared transactions are left to Rollback
+			skipped := append([]string(nil), preparers[:i]...)
+			skipped = append(skipped, preparers[i+1:]...)
+			if len(last) > 0 {
+				skipped = append(skipped, last)
+			}
+			return &CommitError{
+				Failed:   []string{key},
+				Skipped:  skipped,
+				Errs:     []*KeyError{{Key: key, Err: err}},
+				Rollback: u.rollbackPrepared(preparers[:i]),
+			}
+		}
+	}
+
+	var committed []string
+	//last resource decides the outcome
+	if len(last) > 0 {
+		tx := u.txOf(last)
+		if err := u.commitTxn(ctx, last, tx); err != nil {
+			return &CommitError{
+				Failed:   []string{last},
+				Skipped:  preparers,
+				Errs:     []*KeyError{{Key: last, Err: err}},
+				Rollback: u.rollbackPrepared(preparers),
+			}
+		}
+		u.removeTx(last)
+		committed = append(committed, last)
+	}
+
+	//phase two. prepared transaction should not fail, but still try to commit all of them
+	var failed []string
+	var errs []*KeyError
+	for _, key := range preparers {
+		tx := u.txOf(key)
+		if err := u.trace(SpanCommit, key, tx.(Preparer).CommitPrepared); err != nil {
+			failed = append(failed, key)
+			errs = append(errs, &KeyError{Key: key, Err: err})
+		} else {
+			committed = append(committed, key)
+		}
+		u.removeTx(key)
+	}
+	if len(errs) > 0 {
+		return &CommitError{Committed: committed, Failed: failed, Errs: errs}
+	}
+	return nil
+}
+
+// rollbackPrepared rollback prepared transactions of keys and remove them from unit of work
+func (u *UnitOfWork) rollbackPrepared(keys []string) *RollbackError {
+	var errs []*KeyError
+	for _, key := range keys {
+		tx := u.txOf(key)
+		if err := u.trace(SpanRollback, key, tx.(Preparer).RollbackPrepared); err != nil {
+			errs = append(errs, &KeyError{Key: key, Err: err})
+		}
+		u.removeTx(key)
+	}
+	if len(errs) > 0 {
+		return &RollbackError{Errs: errs}
+	}
+	return nil
+}
+
+func (u *UnitOfWork) commitTxn(ctx context.Context, key string, tx Txn) error {
+	return u.trace(SpanCommit, key, func() error {
+		if txc, ok := tx.(TxnContext); ok {
+			return txc.CommitContext(ctx)
+		}
+		return tx.Commit()
+	})
+}
+
+func (u *UnitOfWork) rollbackTxn(ctx context.Context, key string, tx Txn) error {
+	return u.trace(SpanRollback, key, func() error {
+		if txc, ok := tx.(TxnContext); ok {
+			return txc.RollbackContext(ctx)
+		}
+		return tx.Rollback()
+	})
+}
+
+func (u *UnitOfWork) txOf(key string) Txn {
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+	tx, _ := u.db.Get(key)
+	return tx
+}
+
+func (u *UnitOfWork) removeTx(key string) {
+	u.mtx.Lock()
+	u.db.Delete(key)
+	delete(u.began, key)
+	u.unwatchSlowKey(key)
+	rel := u.releases[key]
+	delete(u.releases, key)
+	u.mtx.Unlock()
+	if rel != nil {
+		rel.run()
+	}
+}
+
+// openKeys return keys of transactions in order of beginning
+func (u *UnitOfWork) openKeys() []string {
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+	keys := make([]string, 0, u.db.Len())
+	for el := u.db.Front(); el != nil; el = el.Next() {
+		keys = append(keys, el.Key)
+	}
+	return keys
+}
+
+func (u *UnitOfWork) reversedKeys() []string {
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+	keys := make([]string, 0, u.db.Len())
 	for el := u.db.Back(); el != nil; el = el.Prev() {
-		err := el.Value.Rollback()
-		if err != nil {
-			errs = append(errs, err.Error())
+		keys = append(keys, el.Key)
+	}
+	return keys
+}
+
+// Rollback all remaining transactions in reverse order of beginning. Returns *RollbackError if any transaction fails
+func (u *UnitOfWork) Rollback() error {
+	return u.RollbackContext(context.Background())
+}
+
+// RollbackContext is Rollback with context passed to TxnContext.
+// Rollback is allowed after a failed commit to roll back the remaining transactions, the state keeps StateFailed
+func (u *UnitOfWork) RollbackContext(ctx context.Context) error {
+	u.mtx.Lock()
+	switch u.state {
+	case StateActive:
+		u.state = StateRolledBack
+	case StateFailed:
+	default:
+		u.mtx.Unlock()
+		return fmt.Errorf("%w: can not roll back in state %s", ErrUnitOfWorkCompleted, u.state)
+	}
+	u.mtx.Unlock()
+	if u.join && u.parent != nil {
+		//transactions are shared with parent, which can not commit anymore
+		u.parent.SetRollbackOnly()
+	}
+	return u.rollback(ctx)
+}
+
+func (u *UnitOfWork) rollback(ctx context.Context) error {
+	defer u.finish()
+	var errs []*KeyError
+	for _, key := range u.reversedKeys() {
+		tx := u.txOf(key)
+		if err := u.rollbackTxn(ctx, key, tx); err != nil {
+			errs = append(errs, &KeyError{Key: key, Err: err})
 		}
+		u.removeTx(key)
 	}
 	if len(errs) > 0 {
-		return fmt.Errorf(strings.Join(errs, "\n"))
-	} else {
-		return nil
+		return &RollbackError{Errs: errs}
 	}
+	return nil
+}
+
+// SetRollbackOnly mark the unit of work so that commit fails with ErrRollbackOnly.
+// If the unit of work joins its parent, the parent is marked too
+func (u *UnitOfWork) SetRollbackOnly() {
+	u.mtx.Lock()
+	u.rollbackOnly = true
+	u.mtx.Unlock()
+	if u.join && u.parent != nil {
+		u.parent.SetRollbackOnly()
+	}
+}
+
+func (u *UnitOfWork) IsRollbackOnly() bool {
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+	return u.rollbackOnly
+}
+
+// IsReadOnly reports whether the unit of work is created with ReadOnly
+func (u *UnitOfWork) IsReadOnly() bool {
+	return u.readOnly
 }
 
 func (u *UnitOfWork) GetId() string {
 	return u.id
 }
 
+// Name of unit of work, set by NewOption Name
+func (u *UnitOfWork) Name() string {
+	return u.name
+}
+
+// Labels return a copy of labels set by NewOption Labels
+func (u *UnitOfWork) Labels() map[string]string {
+	labels := make(map[string]string, len(u.labels))
+	for k, v := range u.labels {
+		labels[k] = v
+	}
+	return labels
+}
+
 func (u *UnitOfWork) GetTxDb(ctx context.Context, keys ...string) (tx Txn, err error) {
-	u.mtx.Lock()
-	defer u.mtx.Unlock()
+	//same TxOptions as the registered ResourceKey
+	keyOpt := u.keyOpt[u.formatter(keys...)]
+	keys, err = u.resolveKeys(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	return u.getTxDb(ctx, keys, keyOpt)
+}
+
+// resolveKeys check keys in strict mode, then enrich keys from ctx
+func (u *UnitOfWork) resolveKeys(ctx context.Context, keys []string) ([]string, error) {
+	if u.knownKeys != nil {
+		key := u.formatter(keys...)
+		if _, ok := u.knownKeys[key]; !ok {
+			return nil, &UnknownKeyError{Key: key}
+		}
+	}
+	for _, enrich := range u.enrichers {
+		keys = enrich(ctx, keys)
+	}
+	return keys, nil
+}
+
+// getTxDb resolve transaction of enriched keys, begin with keyOpt if not nil
+func (u *UnitOfWork) getTxDb(ctx context.Context, keys []string, keyOpt []*sql.TxOptions) (tx Txn, err error) {
 	key := u.formatter(keys...)
+	return u.loadOrBegin(ctx, key, func(parent *UnitOfWork) (Txn, error) {
+		return parent.getTxDb(ctx, keys, keyOpt)
+	}, func(ctx context.Context) (Txn, error) {
+		// using factory
+		db, err := u.getFactory()(ctx, keys...)
+		if err != nil {
+			return nil, err
+		}
+		opt := u.txOptions(key, keyOpt)
+		if u.readOnly {
+			opt = readOnly(opt)
+		}
+		return db.Begin(opt...)
+	})
+}
+
+// pendingTxn is a transaction being began
+type pendingTxn struct {
+	done chan struct{}
+	tx   Txn
+	err  error
+}
+
+// loadOrBegin return transaction of [key] if exists, or delegate to parent if join, or [begin] a new one.
+// No lock is held while calling parent or [begin], so different keys begin in parallel and the same key begins exactly once.
+// Functions registered by OnRelease in [begin] run when the transaction is removed
+func (u *UnitOfWork) loadOrBegin(ctx context.Context, key string, fromParent func(parent *UnitOfWork) (Txn, error), begin func(ctx context.Context) (Txn, error)) (Txn, error) {
+	u.mtx.Lock()
+	if u.state != StateActive {
+		u.mtx.Unlock()
+		return nil, fmt.Errorf("%w: can not get transaction in state %s", ErrUnitOfWorkCompleted, u.state)
+	}
 	if tx, ok := u.db.Get(key); ok {
+		u.mtx.Unlock()
 		return tx, nil
 	}
-
 	//find from parent, no not begin new
-	if u.parent != nil && u.disableNested {
-		return u.parent.GetTxDb(ctx, keys...)
+	if u.parent != nil && u.join {
+		u.mtx.Unlock()
+		return fromParent(u.parent)
+	}
+	if p, ok := u.pending[key]; ok {
+		u.mtx.Unlock()
+		select {
+		case <-p.done:
+			return p.tx, p.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
 	}
+	p := &pendingTxn{done: make(chan struct{})}
+	u.pending[key] = p
+	u.mtx.Unlock()
 
-	// using factory
-	db, err := u.getFactory()(ctx, keys...)
+	var tx Txn
+	rel := &releases{}
+	err := u.trace(SpanBegin, key, func() (err error) {
+		tx, err = begin(context.WithValue(ctx, releasesKey{}, rel))
+		return
+	})
 	if err != nil {
-		return nil, err
+		rel.run()
 	}
-	//begin new transaction
-	tx, err = db.Begin(u.opt...)
-	if err != nil {
-		return nil, err
+
+	u.mtx.Lock()
+	delete(u.pending, key)
+	var late Txn
+	if err == nil && u.state != StateActive {
+		//completed while beginning
+		late = tx
+		tx, err = nil, fmt.Errorf("%w: can not get transaction in state %s", ErrUnitOfWorkCompleted, u.state)
+	}
+	if err == nil {
+		u.db.Set(key, tx)
+		u.began[key] = time.Now()
+		u.releases[key] = rel
+		u.watchSlowKey(key)
+	}
+	p.tx, p.err = tx, err
+	close(p.done)
+	u.mtx.Unlock()
+	if late != nil {
+		//roll back without lock, as it calls driver, tracer and metrics
+		_ = u.rollbackTxn(detach(ctx), key, late)
+		rel.run()
 	}
-	u.db.Set(key, tx)
-	return
+	return tx, err
 }
 
 func (u *UnitOfWork) getFactory() DbFactory {
 	return func(ctx context.Context, keys ...string) (TransactionalDb, error) {
 		//find from current
-		if tx, ok := u.db.Get(u.formatter(keys...)); ok {
+		if tx := u.txOf(u.formatter(keys...)); tx != nil {
 			if tdb, ok := tx.(TransactionalDb); ok {
 				return tdb, nil
 			}
@@ -115,26 +526,66 @@ func WithUnitOfWork(ctx context.Context, u *UnitOfWork, fn func(ctx context.Cont
 	return WithCurrentUnitOfWork(ctx, fn)
 }
 
-// WithCurrentUnitOfWork wrap a function into current unit of work. Automatically Rollback if function returns error
+// WithCurrentUnitOfWork wrap a function into current unit of work. Automatically Rollback if function returns error.
+// Goroutines started by Go or Group are waited before commit, their errors and panics also cause Rollback.
+// If ctx is done when function returns, the unit of work rolls back and returns an error wrapping ctx.Err().
+// Callbacks registered by OnCommitted, OnRolledBack and OnCompleted run after the unit of work finishes
 func WithCurrentUnitOfWork(ctx context.Context, fn func(ctx context.Context) error) (err error) {
 	uow, ok := FromCurrentUow(ctx)
 	if !ok {
 		return ErrUnitOfWorkNotFound
 	}
 	panicked := true
+	start := time.Now()
+	var elapsed time.Duration
 	defer func() {
-		if panicked || err != nil {
-			if rerr := uow.Rollback(); rerr != nil {
-				err = fmt.Errorf("rolling back transaction fail: %s\n %w ", rerr.Error(), err)
+		if panicked {
+			//children may still use transactions
+			_ = uow.waitChildren()
+			elapsed = time.Since(start)
+		}
+		if (panicked || err != nil) && !uow.finished() {
+			//ctx may be done, roll back anyway
+			if rerr := uow.RollbackContext(detach(ctx)); rerr != nil {
+				var rbErr *RollbackError
+				if errors.As(rerr, &rbErr) {
+					rbErr.Cause = err
+					err = rerr
+				}
 			}
 		}
+		if !uow.join || uow.parent == nil {
+			uow.metrics.UnitOfWorkCompleted(uow.name, uow.outcome(panicked), elapsed)
+		}
+		if panicked {
+			uow.complete(ctx, ErrPanicked)
+		} else {
+			uow.complete(ctx, err)
+		}
 	}()
-	if err = fn(ctx); err != nil {
-		panicked = false
-		return
+	err = fn(ctx)
+	//wait for goroutines started by Go or Group
+	if cerr := uow.waitChildren(); err == nil {
+		err = cerr
 	}
+	elapsed = time.Since(start)
 	panicked = false
-	if rerr := uow.Commit(); rerr != nil {
+	if aerr := uow.abortedErr(); aerr != nil {
+		//fn fails as transactions are rolled back underneath
+		err = aerr
+		return
+	}
+	if err != nil {
+		return
+	}
+	if cerr := ctx.Err(); cerr != nil {
+		err = fmt.Errorf("unit of work aborted before commit: %w", cerr)
+		return
+	}
+	if rerr := uow.CommitContext(ctx); rerr != nil {
+		if aerr := uow.abortedErr(); aerr != nil {
+			return aerr
+		}
 		return fmt.Errorf("committing transaction fail: %w", rerr)
 	}
 	return nil